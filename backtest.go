@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"traderider/internal/backtest"
+	"traderider/internal/config"
+	"traderider/internal/exchange"
+	"traderider/internal/market"
+	"traderider/internal/notifier"
+	"traderider/internal/store"
+	"traderider/internal/trader"
+	"traderider/internal/wallet"
+)
+
+// dataFlags collects repeated -data SYMBOL=path arguments.
+type dataFlags map[string]string
+
+func (d dataFlags) String() string {
+	return fmt.Sprint(map[string]string(d))
+}
+
+func (d dataFlags) Set(v string) error {
+	symbol, path, ok := strings.Cut(v, "=")
+	if !ok || symbol == "" || path == "" {
+		return fmt.Errorf("expected SYMBOL=path, got %q", v)
+	}
+	d[strings.ToUpper(symbol)] = path
+	return nil
+}
+
+// runBacktest replays CSV price files, or a window of history recorded by
+// the live bot, through the live trading logic:
+//
+//	go run . backtest -data BTCUSDC=btc_1m.csv -data SOLUSDC=sol_1m.csv
+//	go run . backtest -history traderider.db -symbols BTCUSDC -from 2025-01-02T10:00:00Z -to 2025-01-02T12:00:00Z
+func runBacktest(args []string) {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	data := dataFlags{}
+	fs.Var(data, "data", "SYMBOL=path to a tick or OHLCV CSV file (repeatable)")
+	configPath := fs.String("config", "config/config.yml", "config file")
+	balance := fs.Float64("balance", 1000, "starting balance in the quote asset")
+	slippage := fs.Float64("slippage", 0.0005, "fractional slippage applied to market orders")
+	spread := fs.Float64("spread", 0.0005, "bid/ask spread reported to the strategy")
+	minNotional := fs.Float64("min-notional", 5, "minimum order notional")
+	stepSize := fs.Float64("step-size", 0.00001, "order quantity step size")
+	step := fs.Duration("step", 5*time.Second, "simulated interval between trader evaluations")
+	dbPath := fs.String("db", "", "SQLite file to record trades in (default: temporary)")
+	out := fs.String("out", "", "write the full result as JSON to this file")
+	history := fs.String("history", "", "replay recorded prices from this bot database instead of CSV files")
+	historySymbols := fs.String("symbols", "", "comma-separated symbols to replay with -history")
+	fromFlag := fs.String("from", "", "start of the -history window (RFC3339 or unix time)")
+	toFlag := fs.String("to", "", "end of the -history window (default: now)")
+	fs.Parse(args)
+
+	if len(data) == 0 && *history == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.Load(*configPath)
+
+	var ticks []backtest.Tick
+	for symbol, path := range data {
+		t, err := backtest.LoadCSV(symbol, path)
+		if err != nil {
+			log.Fatalf("[BACKTEST] %v", err)
+		}
+		ticks = append(ticks, t...)
+	}
+	if *history != "" {
+		t, err := loadHistoryWindow(*history, *historySymbols, *fromFlag, *toFlag)
+		if err != nil {
+			log.Fatalf("[BACKTEST] %v", err)
+		}
+		ticks = append(ticks, t...)
+	}
+
+	quiet := notifier.NewWhatsAppNotifier("", "")
+	factory := func(symbol string, ex exchange.Exchange, mw *market.MarketWatcher, wm *wallet.WalletManager, db *store.Store) *trader.Trader {
+		return newTrader(cfg, symbol, db, mw, ex, wm, quiet)
+	}
+
+	res, err := backtest.Run(ticks, backtest.Options{
+		StartingBalance: *balance,
+		CommissionRate:  cfg.Strategy.CommissionRate,
+		Slippage:        *slippage,
+		Spread:          *spread,
+		Filter:          exchange.SymbolFilter{MinQty: *stepSize, StepSize: *stepSize, MinNotional: *minNotional, ApplyMinToMarket: true},
+		StepInterval:    *step,
+		DBPath:          *dbPath,
+	}, factory)
+	if err != nil {
+		log.Fatalf("[BACKTEST] %v", err)
+	}
+
+	fmt.Printf("\n=== Backtest %s → %s ===\n", res.Start.Format(time.RFC3339), res.End.Format(time.RFC3339))
+	for _, t := range res.Trades {
+		fmt.Printf("%s  %-10s %-4s %.6f @ %.4f\n", t.Time.Format("2006-01-02 15:04:05"), t.Symbol, t.Side, t.Amount, t.Price)
+	}
+	fmt.Printf("\n%-10s %8s %6s %8s %10s %10s %10s\n", "Symbol", "Trades", "Win%", "Profit", "AvgProfit", "AvgLoss", "Score")
+	for symbol, s := range res.Stats {
+		fmt.Printf("%-10s %8d %5.1f%% %8.2f %10.2f %10.2f %10.2f\n",
+			symbol, s.TotalTrades, s.WinRate*100, s.TotalProfit, s.AvgProfit, s.AvgLoss, s.Score)
+	}
+	fmt.Printf("\nStart value: %.2f %s  End value: %.2f %s  Return: %.2f%%\n", res.StartValue, res.Quote, res.EndValue, res.Quote, res.Return*100)
+
+	if *out != "" {
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*out, data, 0644)
+		}
+		if err != nil {
+			log.Fatalf("[BACKTEST] Failed to write %s: %v", *out, err)
+		}
+	}
+}
+
+func loadHistoryWindow(path, symbols, fromFlag, toFlag string) ([]backtest.Tick, error) {
+	if symbols == "" || fromFlag == "" {
+		return nil, fmt.Errorf("-history requires -symbols and -from")
+	}
+	from, err := backtest.ParseTime(fromFlag)
+	if err != nil {
+		return nil, err
+	}
+	to := time.Now()
+	if toFlag != "" {
+		if to, err = backtest.ParseTime(toFlag); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := store.NewStore(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.DB.Close()
+
+	var ticks []backtest.Tick
+	for _, symbol := range strings.Split(symbols, ",") {
+		t, err := backtest.LoadHistory(db, strings.ToUpper(strings.TrimSpace(symbol)), from, to)
+		if err != nil {
+			return nil, err
+		}
+		ticks = append(ticks, t...)
+	}
+	return ticks, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"traderider/internal/api"
+	"traderider/internal/exchange"
+	"traderider/internal/market"
+	"traderider/internal/trader"
+	"traderider/internal/wallet"
+)
+
+// hardStop pauses every trader that is not stopped once the portfolio has
+// lost 10% of its baseline value. Assets that cannot be valued, now or at
+// the baseline, are left out of both values. The pause is saved, so the
+// traders stay paused after a restart until resumed; resuming one re-arms
+// the stop from the portfolio value at that point.
+type hardStop struct {
+	symbols  []string
+	wm       *wallet.WalletManager
+	mw       *market.MarketWatcher
+	ex       exchange.Exchange
+	currency string
+	traders  map[string]*trader.Trader
+
+	start        map[string]float64 // baseline value per asset
+	startMissing []string
+	tripped      bool
+	lastMissing  string
+}
+
+func newHardStop(symbols []string, wm *wallet.WalletManager, mw *market.MarketWatcher, ex exchange.Exchange, currency string, traders map[string]*trader.Trader) *hardStop {
+	h := &hardStop{symbols: symbols, wm: wm, mw: mw, ex: ex, currency: currency, traders: traders}
+	h.start, h.startMissing = h.values()
+	if len(h.startMissing) > 0 {
+		log.Printf("[WARN] Cannot value %v in %s; the hard stop only counts the rest", h.startMissing, currency)
+	}
+	return h
+}
+
+// monitor checks the portfolio every 10 seconds until ctx is done.
+func (h *hardStop) monitor(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		h.check()
+	}
+}
+
+func (h *hardStop) values() (map[string]float64, []string) {
+	values, missing := api.PortfolioValues(h.symbols, h.wm, h.mw, h.ex, h.currency)
+	sort.Strings(missing)
+	return values, missing
+}
+
+// check compares the portfolio with the baseline and pauses the traders on
+// a 10% loss. Once tripped it waits for a trader to be resumed.
+func (h *hardStop) check() {
+	values, missing := h.values()
+	if h.tripped {
+		if !h.resumed() {
+			return
+		}
+		h.tripped = false
+		h.start, h.startMissing = values, missing
+		log.Printf("[HARD-STOP] Trader resumed; re-armed at %.2f %s", sum(values, nil), h.currency)
+		return
+	}
+
+	if m := strings.Join(missing, ","); m != h.lastMissing {
+		if m != "" {
+			log.Printf("[HARD-STOP] Cannot value %v in %s; comparing the rest", missing, h.currency)
+		}
+		h.lastMissing = m
+	}
+	skip := make(map[string]bool)
+	for _, asset := range append(missing, h.startMissing...) {
+		skip[asset] = true
+	}
+	value, startValue := sum(values, skip), sum(h.start, skip)
+	if value >= startValue*0.9 {
+		return
+	}
+
+	log.Printf("[HARD-STOP] Portfolio value %.2f %s < 90%% of start %.2f. Pausing all traders.", value, h.currency, startValue)
+	for symbol, tr := range h.traders {
+		// A stopped trader is already out and must stay stopped.
+		if tr.Mode() == trader.ModeStopped {
+			continue
+		}
+		if err := tr.SetMode(trader.ModePaused); err != nil {
+			log.Printf("[HARD-STOP] %s: %v", symbol, err)
+		}
+	}
+	h.tripped = true
+}
+
+// resumed reports whether a trader trades again after the stop paused them.
+func (h *hardStop) resumed() bool {
+	for _, tr := range h.traders {
+		if mode := tr.Mode(); mode == trader.ModeActive || mode == trader.ModeNoEntries {
+			return true
+		}
+	}
+	return false
+}
+
+func sum(values map[string]float64, skip map[string]bool) float64 {
+	total := 0.0
+	for asset, v := range values {
+		if !skip[asset] {
+			total += v
+		}
+	}
+	return total
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"traderider/internal/exchange"
+	"traderider/internal/market"
+	"traderider/internal/notifier"
+	"traderider/internal/paper"
+	"traderider/internal/store"
+	"traderider/internal/strategy"
+	"traderider/internal/trader"
+	"traderider/internal/wallet"
+)
+
+type testFeed struct {
+	mu    sync.Mutex
+	price float64
+}
+
+func (f *testFeed) GetSymbolPrice(symbol string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.price
+}
+
+func (f *testFeed) GetSpread(symbol string) float64 { return 0.0001 }
+
+func (f *testFeed) GetSymbolFilter(symbol string) exchange.SymbolFilter {
+	return exchange.SymbolFilter{BaseAsset: "BTC", QuoteAsset: "USDC"}
+}
+
+type hardStopEnv struct {
+	hs   *hardStop
+	tr   *trader.Trader
+	ex   *paper.Exchange
+	feed *testFeed
+	mw   *market.MarketWatcher
+	wm   *wallet.WalletManager
+}
+
+// newHardStopEnv watches a running BTCUSDC trader on a paper exchange with
+// 1000 USDC and 0.02 BTC at 50000, so 2000 USDC in all.
+func newHardStopEnv(t *testing.T) *hardStopEnv {
+	t.Helper()
+	db, err := store.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	feed := &testFeed{price: 50000}
+	ex := paper.NewExchange(feed, paper.Config{StartingBalances: map[string]float64{"USDC": 1000, "BTC": 0.02}})
+	mw := market.NewWatcher(ex)
+	mw.Record("BTCUSDC", feed.price, time.Now())
+	n := notifier.NewWhatsAppNotifier("", "")
+	wm := wallet.NewWalletManager(ex, n, "USDC")
+	wm.Update()
+	tr := trader.NewTrader(db, mw, strategy.NewEngine(5, 20, 0.01), trader.Config{InvestmentPerTrade: 100}, ex, wm, n)
+	tr.Symbol = "BTCUSDC"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tr.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	traders := map[string]*trader.Trader{"BTCUSDC": tr}
+	hs := newHardStop([]string{"BTCUSDC"}, wm, mw, ex, "USDC", traders)
+	return &hardStopEnv{hs: hs, tr: tr, ex: ex, feed: feed, mw: mw, wm: wm}
+}
+
+func (e *hardStopEnv) setPrice(price float64) {
+	e.feed.mu.Lock()
+	e.feed.price = price
+	e.feed.mu.Unlock()
+	e.mw.Record("BTCUSDC", price, time.Now())
+}
+
+func (e *hardStopEnv) wantMode(t *testing.T, want string) {
+	t.Helper()
+	if got := e.tr.Mode(); got != want {
+		t.Fatalf("mode = %q, want %q", got, want)
+	}
+}
+
+func TestHardStopRearmsAfterResume(t *testing.T) {
+	e := newHardStopEnv(t)
+
+	e.setPrice(46000) // 1920: within 10%
+	e.hs.check()
+	e.wantMode(t, trader.ModeActive)
+
+	e.setPrice(35000) // 1700
+	e.hs.check()
+	e.wantMode(t, trader.ModePaused)
+	e.hs.check()
+	e.wantMode(t, trader.ModePaused)
+
+	if err := e.tr.SetMode(trader.ModeActive); err != nil {
+		t.Fatal(err)
+	}
+	e.hs.check()      // re-armed at 1700
+	e.setPrice(30000) // 1600: within 10% of 1700
+	e.hs.check()
+	e.wantMode(t, trader.ModeActive)
+
+	e.setPrice(25000) // 1500
+	e.hs.check()
+	e.wantMode(t, trader.ModePaused)
+}
+
+func TestHardStopLeavesStoppedTraders(t *testing.T) {
+	e := newHardStopEnv(t)
+	if err := e.tr.SellAndStop(); err != nil {
+		t.Fatal(err)
+	}
+	e.setPrice(25000) // the trader never knew of the BTC, so it is still held
+	e.hs.check()
+	e.wantMode(t, trader.ModeStopped)
+}
+
+func TestHardStopValuesProtectedPosition(t *testing.T) {
+	e := newHardStopEnv(t)
+	// Protecting the BTC moves it out of the free balance.
+	if _, err := e.ex.PlaceOCO("BTCUSDC", 0.02, 55000, 46000, 45900); err != nil {
+		t.Fatal(err)
+	}
+	e.wm.Update()
+	e.hs.check()
+	e.wantMode(t, trader.ModeActive)
+	if values, _ := e.hs.values(); values["BTC"] != 1000 {
+		t.Errorf("BTC valued at %v, want 1000", values["BTC"])
+	}
+}
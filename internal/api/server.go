@@ -3,26 +3,33 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
-	"traderider/internal/binance"
+	"traderider/internal/config"
+	"traderider/internal/exchange"
 	"traderider/internal/market"
+	"traderider/internal/performance"
+	"traderider/internal/store"
 	"traderider/internal/trader"
 	"traderider/internal/wallet"
 )
 
 type Server struct {
 	DB           *sql.DB
+	Store        *store.Store
 	Router       *mux.Router
 	Market       *market.MarketWatcher
 	Traders      map[string]*trader.Trader
 	Wallet       *wallet.WalletManager
-	Binance      *binance.Client
+	Exchange     exchange.Exchange
 	TrackedPairs []string
+	Config       *config.Config
 }
 
 type PricePoint struct {
@@ -37,13 +44,14 @@ type TransactionPoint struct {
 	Amount float64 `json:"amount"`
 }
 
-func NewServer(db *sql.DB, market *market.MarketWatcher, traders map[string]*trader.Trader, wallet *wallet.WalletManager, binClient *binance.Client, symbols []string) *Server {
+func NewServer(db *store.Store, market *market.MarketWatcher, traders map[string]*trader.Trader, wallet *wallet.WalletManager, ex exchange.Exchange, symbols []string) *Server {
 	s := &Server{
-		DB:           db,
+		DB:           db.DB,
+		Store:        db,
 		Market:       market,
 		Traders:      traders,
 		Wallet:       wallet,
-		Binance:      binClient,
+		Exchange:     ex,
 		TrackedPairs: symbols,
 		Router:       mux.NewRouter(),
 	}
@@ -55,10 +63,22 @@ func (s *Server) routes() {
 	s.Router.HandleFunc("/api/transactions/{symbol}", s.handleTransactions).Methods("GET")
 	s.Router.HandleFunc("/api/summary/{symbol}", s.handleSummary).Methods("GET")
 	s.Router.HandleFunc("/api/chart-data/{symbol}", s.handleChartData).Methods("GET")
+	s.Router.HandleFunc("/api/candles/{symbol}", s.handleCandles).Methods("GET")
+	s.Router.HandleFunc("/api/history/{symbol}", s.handleHistory).Methods("GET")
 	s.Router.HandleFunc("/api/wallet", s.handleWallet).Methods("GET")
 	s.Router.HandleFunc("/api/force-sell/{symbol}", s.handleForceSell).Methods("POST")
+	s.Router.HandleFunc("/api/traders", s.handleTraders).Methods("GET")
+	s.Router.HandleFunc("/api/traders/{symbol}/{action}", s.handleTraderAction).Methods("POST")
 	s.Router.HandleFunc("/api/performance", s.handlePerformance).Methods("GET")
 	s.Router.HandleFunc("/api/rebalance", s.handleRebalance).Methods("GET")
+	s.Router.HandleFunc("/api/config", s.handleConfig).Methods("GET")
+	s.Router.HandleFunc("/api/health", s.handleHealth).Methods("GET")
+	s.Router.HandleFunc("/api/orders", s.handleOrders).Methods("GET")
+	s.Router.HandleFunc("/api/orders/{id}", s.handleOrder).Methods("GET")
+	s.Router.HandleFunc("/api/positions", s.handlePositions).Methods("GET")
+	s.Router.HandleFunc("/api/reconcile", s.handleReconciliations).Methods("GET")
+	s.Router.HandleFunc("/api/reconcile/{symbol}", s.handleReconcile).Methods("POST")
+	s.Router.HandleFunc("/api/reconcile/{symbol}/ack", s.handleAcknowledge).Methods("POST")
 }
 
 func (s *Server) handleTransactions(w http.ResponseWriter, r *http.Request) {
@@ -111,6 +131,8 @@ func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
 	usdcProfit := rawSummary["usdcProfit"]
 
 	summary["priceNow"] = price
+	summary["mode"] = tr.Mode()
+	summary["baseAsset"], summary["quoteAsset"] = exchange.Assets(s.Exchange, symbol)
 	summary["investedNow"] = assetHeld * price
 	summary["usdcInvestedTotal"] = usdcInvested + usdcProfit
 
@@ -120,16 +142,13 @@ func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleChartData(w http.ResponseWriter, r *http.Request) {
 	symbol := mux.Vars(r)["symbol"]
-	history := s.Market.GetHistory(symbol)
+	ticks := s.Market.GetTicks(symbol)
 
 	var pricePoints []PricePoint
-	startTime := time.Now().Add(-time.Duration(len(history)) * time.Second)
-
-	for i, price := range history {
-		timestamp := startTime.Add(time.Duration(i) * time.Second).Format(time.RFC3339)
+	for _, tick := range ticks {
 		pricePoints = append(pricePoints, PricePoint{
-			Time:  timestamp,
-			Price: price,
+			Time:  tick.Time.Format(time.RFC3339),
+			Price: tick.Price,
 		})
 	}
 
@@ -162,28 +181,303 @@ func (s *Server) handleChartData(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) handleCandles(w http.ResponseWriter, r *http.Request) {
+	symbol := mux.Vars(r)["symbol"]
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "1m"
+	}
+	if _, ok := market.Intervals[interval]; !ok {
+		http.Error(w, "Unknown interval", http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Market.GetCandles(symbol, interval, limit))
+}
+
+// handleHistory serves recorded prices from the database for a time range:
+// /api/history/{symbol}?from=...&to=...&interval=1m. Times are RFC3339 or unix
+// seconds; the range defaults to the last hour. Without an interval the
+// one-second ticks are returned.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	symbol := mux.Vars(r)["symbol"]
+	q := r.URL.Query()
+
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			http.Error(w, "Invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+
+	var result interface{}
+	var err error
+	if interval := q.Get("interval"); interval != "" {
+		if _, ok := market.Intervals[interval]; !ok {
+			http.Error(w, "Unknown interval", http.StatusBadRequest)
+			return
+		}
+		var candles []store.Candle
+		candles, err = s.Store.GetCandles(symbol, interval, from, to)
+		points := make([]market.Candle, len(candles))
+		for i, c := range candles {
+			points[i] = market.Candle(c)
+		}
+		result = points
+	} else {
+		var ticks []store.PriceTick
+		ticks, err = s.Store.GetTicks(symbol, from, to)
+		points := make([]market.Tick, len(ticks))
+		for i, t := range ticks {
+			points[i] = market.Tick(t)
+		}
+		result = points
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func parseQueryTime(v string) (time.Time, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// handleOrders lists recorded orders with their fills, newest first:
+// /api/orders?symbol=BTCUSDC&status=FILLED&position=12&limit=50.
+func (s *Server) handleOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := store.OrderFilter{Symbol: q.Get("symbol"), Status: q.Get("status")}
+	if v := q.Get("position"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid position", http.StatusBadRequest)
+			return
+		}
+		f.PositionID = id
+	}
+	f.Limit, _ = strconv.Atoi(q.Get("limit"))
+
+	orders, err := s.Store.GetOrders(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// handleOrder returns one recorded order with its status history and fills.
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order id", http.StatusBadRequest)
+		return
+	}
+	order, err := s.Store.GetOrder(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// handlePositions lists positions, newest first: /api/positions?symbol=BTCUSDC&limit=50.
+func (s *Server) handlePositions(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	positions, err := s.Store.GetPositions(r.URL.Query().Get("symbol"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(positions)
+}
+
+// handleReconciliations returns the last startup reconciliation per symbol.
+func (s *Server) handleReconciliations(w http.ResponseWriter, r *http.Request) {
+	result := make(map[string]*trader.Reconciliation)
+	for symbol, tr := range s.Traders {
+		result[symbol] = tr.Reconciliation()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleReconcile checks a symbol again, e.g. after stray orders were cancelled by hand.
+func (s *Server) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	tr, ok := s.Traders[mux.Vars(r)["symbol"]]
+	if !ok {
+		http.Error(w, "Trader not found", http.StatusNotFound)
+		return
+	}
+	rec, err := tr.ReconcileAgain()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// handleAcknowledge lets a symbol with reconciliation issues trade again.
+func (s *Server) handleAcknowledge(w http.ResponseWriter, r *http.Request) {
+	tr, ok := s.Traders[mux.Vars(r)["symbol"]]
+	if !ok {
+		http.Error(w, "Trader not found", http.StatusNotFound)
+		return
+	}
+	if err := tr.Acknowledge(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tr.Reconciliation())
+}
+
+// handleHealth reports the exchange connection: clock offset, request weight
+// and any problems, with 503 while there are problems.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{"status": "ok"}
+	if s.Config != nil {
+		resp["mode"] = s.Config.Mode
+	}
+	status := http.StatusOK
+	if hr, ok := s.Exchange.(exchange.HealthReporter); ok {
+		h := hr.Health()
+		resp["exchange"] = h
+		if len(h.Problems) > 0 {
+			resp["status"] = "degraded"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleConfig reports the effective per-symbol parameters, after defaults
+// and overrides, without credentials.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if s.Config == nil {
+		http.Error(w, "Config not available", http.StatusNotFound)
+		return
+	}
+	symbols := make(map[string]config.StrategyConfig)
+	for _, symbol := range s.TrackedPairs {
+		symbols[symbol] = s.Config.ParamsFor(symbol)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":                 s.Config.Mode,
+		"testnet":              s.Config.Binance.UseTestnet,
+		"reportingCurrency":    s.reportingCurrency(),
+		"symbols":              symbols,
+		"historyRetentionDays": s.Config.History.RetentionDays,
+	})
+}
+
 // 🔹 TotalWallet handler
 func (s *Server) handleWallet(w http.ResponseWriter, r *http.Request) {
-	total := TotalPortfolioValue(s.TrackedPairs, s.Wallet, s.Market, s.Binance)
-	resp := map[string]float64{
+	currency := s.reportingCurrency()
+	total, missing := TotalPortfolioValue(s.TrackedPairs, s.Wallet, s.Market, s.Exchange, currency)
+	resp := map[string]interface{}{
 		"totalWalletValue": total,
+		"currency":         currency,
+		"balances":         s.Wallet.Balances(),
+	}
+	if len(missing) > 0 {
+		resp["unconverted"] = missing
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
-// 🔹 Util func
-func TotalPortfolioValue(symbols []string, wm *wallet.WalletManager, mw *market.MarketWatcher, binClient *binance.Client) float64 {
-	total := wm.Balance()
+func (s *Server) reportingCurrency() string {
+	if s.Config == nil || s.Config.ReportingCurrency == "" {
+		return "USDC"
+	}
+	return s.Config.ReportingCurrency
+}
+
+// TotalPortfolioValue values the wallet's quote balances and the base asset
+// of each symbol in currency, including what open orders such as
+// protective stops hold. Assets that cannot be converted are left out
+// and returned in missing.
+func TotalPortfolioValue(symbols []string, wm *wallet.WalletManager, mw *market.MarketWatcher, ex exchange.Exchange, currency string) (float64, []string) {
+	values, missing := PortfolioValues(symbols, wm, mw, ex, currency)
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total, missing
+}
+
+// PortfolioValues is TotalPortfolioValue per asset.
+func PortfolioValues(symbols []string, wm *wallet.WalletManager, mw *market.MarketWatcher, ex exchange.Exchange, currency string) (map[string]float64, []string) {
+	values, missing := wm.ValuesIn(currency)
+	for _, asset := range wm.Assets() {
+		if locked := exchange.LockedBalance(ex, asset); locked > 0 {
+			if rate := exchange.ConversionRate(ex, asset, currency); rate > 0 {
+				values[asset] += locked * rate
+			}
+		}
+	}
+	seen := make(map[string]bool)
 	for _, symbol := range symbols {
-		asset := symbol[:len(symbol)-4] // ex: BTCUSDC → BTC
-		balance, err := binClient.GetAssetBalance(asset)
-		if err == nil {
-			price := mw.GetPrice(symbol)
-			total += balance * price
+		base, quote := exchange.Assets(ex, symbol)
+		if seen[base] {
+			continue
+		}
+		seen[base] = true
+		balance, err := ex.GetAssetBalance(base)
+		if err != nil {
+			continue
 		}
+		balance += exchange.LockedBalance(ex, base)
+		if balance == 0 {
+			continue
+		}
+		rate := exchange.ConversionRate(ex, quote, currency)
+		if rate == 0 {
+			missing = append(missing, base)
+			continue
+		}
+		values[base] += balance * mw.GetPrice(symbol) * rate
 	}
-	return total
+	return values, missing
 }
 
 func (s *Server) handleForceSell(w http.ResponseWriter, r *http.Request) {
@@ -194,11 +488,63 @@ func (s *Server) handleForceSell(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tr.ForceSell()
+	if err := tr.ForceSell(); err != nil {
+		http.Error(w, "Force sell failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Force sell executed"))
 }
 
+// handleTraders returns the mode of every trader.
+func (s *Server) handleTraders(w http.ResponseWriter, r *http.Request) {
+	modes := make(map[string]string)
+	for symbol, tr := range s.Traders {
+		modes[symbol] = tr.Mode()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(modes)
+}
+
+// handleTraderAction changes a trader's mode: pause-entries, pause, resume
+// or sell-and-stop.
+func (s *Server) handleTraderAction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tr, ok := s.Traders[vars["symbol"]]
+	if !ok {
+		http.Error(w, "Trader not found", http.StatusNotFound)
+		return
+	}
+
+	var err error
+	switch vars["action"] {
+	case "pause-entries":
+		err = tr.SetMode(trader.ModeNoEntries)
+	case "pause":
+		err = tr.SetMode(trader.ModePaused)
+	case "resume":
+		err = tr.SetMode(trader.ModeActive)
+	case "sell-and-stop":
+		err = tr.SellAndStop()
+	default:
+		http.Error(w, "Unknown action", http.StatusNotFound)
+		return
+	}
+	switch {
+	case errors.Is(err, trader.ErrStopped):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil && vars["action"] == "sell-and-stop":
+		http.Error(w, "Stopped, but: "+err.Error(), http.StatusBadGateway)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"symbol": vars["symbol"], "mode": tr.Mode()})
+}
+
 func (s *Server) handleRebalance(w http.ResponseWriter, r *http.Request) {
 	s.RebalanceAllocations()
 	w.WriteHeader(http.StatusOK)
@@ -207,106 +553,36 @@ func (s *Server) handleRebalance(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) RebalanceAllocations() {
 	scores := make(map[string]float64)
-	totalScore := 0.0
 
 	for _, symbol := range s.TrackedPairs {
-		rows, err := s.DB.Query(`
-			SELECT side, amount, price, time FROM transactions
-			WHERE symbol = ? ORDER BY time ASC
-		`, symbol)
+		txs, err := s.Store.GetAllTransactions(symbol)
 		if err != nil {
 			continue
 		}
-		defer rows.Close()
 
-		var stats PerformanceStats
-		var buyStack []struct {
-			amount float64
-			price  float64
-			time   time.Time
-		}
-
-		commission := 0.001
-		var holdingDurations []float64
-
-		for rows.Next() {
-			var side string
-			var price, amt float64
-			var ts string
-			_ = rows.Scan(&side, &amt, &price, &ts)
-			timeParsed, _ := time.Parse("2006-01-02 15:04:05", ts)
-
-			if side == "BUY" {
-				buyStack = append(buyStack, struct {
-					amount float64
-					price  float64
-					time   time.Time
-				}{amt, price, timeParsed})
-			} else if side == "SELL" && len(buyStack) > 0 {
-				amtLeft := amt
-				for len(buyStack) > 0 && amtLeft > 0 {
-					buy := buyStack[0]
-					qty := math.Min(amtLeft, buy.amount)
-
-					buyPrice := buy.price * (1 + commission)
-					sellPrice := price * (1 - commission)
-					profit := (sellPrice - buyPrice) * qty
-
-					stats.TotalProfit += profit
-					stats.TotalTrades++
-					if profit > 0 {
-						stats.Wins++
-						stats.AvgProfit += profit
-					} else {
-						stats.Losses++
-						stats.AvgLoss += profit
-					}
-
-					holdingTime := timeParsed.Sub(buy.time).Minutes()
-					holdingDurations = append(holdingDurations, holdingTime)
-
-					amtLeft -= qty
-					if qty < buy.amount {
-						buyStack[0].amount -= qty
-						break
-					} else {
-						buyStack = buyStack[1:]
-					}
-				}
-			}
-		}
-
-		if stats.Wins > 0 {
-			stats.AvgProfit /= float64(stats.Wins)
-		}
-		if stats.Losses > 0 {
-			stats.AvgLoss /= float64(stats.Losses)
-		}
-		if stats.TotalTrades > 0 {
-			stats.WinRate = float64(stats.Wins) / float64(stats.TotalTrades)
-		}
-		var avgHold float64
-		for _, h := range holdingDurations {
-			avgHold += h
-		}
-		if len(holdingDurations) > 0 {
-			avgHold /= float64(len(holdingDurations))
-		}
+		stats := performance.Compute(txs, s.commissionRate(symbol))
 
 		// Compute normalized score
-		lossAbs := math.Abs(stats.AvgLoss) + 0.01
-		confidence := math.Log(float64(stats.TotalTrades) + 1)
-		score := (stats.TotalProfit / lossAbs) * stats.WinRate * confidence / (avgHold + 1)
-		score = math.Max(score, 0.01) // prevent zero weight
+		score := math.Max(stats.RawScore(), 0.01) // prevent zero weight
 		scores[symbol] = score
-		totalScore += score
 	}
 
-	totalAvailable := 0.8 * s.Wallet.Balance()
+	// Each quote currency's balance is shared among the symbols bought with it.
+	quotes := make(map[string]string)
+	quoteScore := make(map[string]float64)
 	for symbol, score := range scores {
-		weight := score / totalScore
-		amount := weight * totalAvailable
-		s.Traders[symbol].SetInvestmentPerTrade(amount)
-		log.Printf("[REBALANCE] %s → %.2f USDC (%.1f%%)\n", symbol, amount, weight*100)
+		_, quote := exchange.Assets(s.Exchange, symbol)
+		quotes[symbol] = quote
+		quoteScore[quote] += score
+	}
+	for symbol, score := range scores {
+		quote := quotes[symbol]
+		weight := score / quoteScore[quote]
+		amount := weight * 0.8 * s.Wallet.Balance(quote)
+		if err := s.Traders[symbol].SetInvestmentPerTrade(amount); err != nil {
+			log.Printf("[REBALANCE] %s: %v\n", symbol, err)
+			continue
+		}
+		log.Printf("[REBALANCE] %s → %.2f %s (%.1f%%)\n", symbol, amount, quote, weight*100)
 	}
 }
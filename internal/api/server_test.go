@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"traderider/internal/exchange"
+	"traderider/internal/market"
+	"traderider/internal/notifier"
+	"traderider/internal/paper"
+	"traderider/internal/store"
+	"traderider/internal/strategy"
+	"traderider/internal/trader"
+	"traderider/internal/wallet"
+)
+
+type testFeed struct{}
+
+func (testFeed) GetSymbolPrice(symbol string) float64 { return 50000 }
+
+func (testFeed) GetSpread(symbol string) float64 { return 0.0001 }
+
+func (testFeed) GetSymbolFilter(symbol string) exchange.SymbolFilter {
+	return exchange.SymbolFilter{BaseAsset: "BTC", QuoteAsset: "USDC"}
+}
+
+// newTestServer serves a running BTCUSDC trader on a paper exchange. stop
+// ends the trader's Run loop.
+func newTestServer(t *testing.T) (srv *Server, stop func()) {
+	t.Helper()
+	db, err := store.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	ex := paper.NewExchange(testFeed{}, paper.Config{StartingBalances: map[string]float64{"USDC": 1000}})
+	mw := market.NewWatcher(ex)
+	mw.Record("BTCUSDC", 50000, time.Now())
+	n := notifier.NewWhatsAppNotifier("", "")
+	wm := wallet.NewWalletManager(ex, n, "USDC")
+	tr := trader.NewTrader(db, mw, strategy.NewEngine(5, 20, 0.01), trader.Config{InvestmentPerTrade: 100}, ex, wm, n)
+	tr.Symbol = "BTCUSDC"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tr.Run(ctx)
+		close(done)
+	}()
+	stop = func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+
+	traders := map[string]*trader.Trader{"BTCUSDC": tr}
+	return NewServer(db, mw, traders, wm, ex, []string{"BTCUSDC"}), stop
+}
+
+func post(srv *Server, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+	return rec
+}
+
+func TestHandleTraderAction(t *testing.T) {
+	srv, _ := newTestServer(t)
+	for _, tc := range []struct {
+		action string
+		mode   string
+	}{
+		{"pause-entries", trader.ModeNoEntries},
+		{"pause", trader.ModePaused},
+		{"resume", trader.ModeActive},
+		{"sell-and-stop", trader.ModeStopped},
+		{"resume", trader.ModeActive},
+	} {
+		rec := post(srv, "/api/traders/BTCUSDC/"+tc.action)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.action, rec.Code, rec.Body)
+		}
+		var resp map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp["mode"] != tc.mode {
+			t.Errorf("%s: mode %q, want %q", tc.action, resp["mode"], tc.mode)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/traders", nil))
+	var modes map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&modes); err != nil {
+		t.Fatal(err)
+	}
+	if modes["BTCUSDC"] != trader.ModeActive {
+		t.Errorf("GET /api/traders = %v", modes)
+	}
+}
+
+func TestHandleTraderActionErrors(t *testing.T) {
+	srv, stop := newTestServer(t)
+	if rec := post(srv, "/api/traders/ETHUSDC/pause"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown symbol: status %d, want 404", rec.Code)
+	}
+	if rec := post(srv, "/api/traders/BTCUSDC/sleep"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown action: status %d, want 404", rec.Code)
+	}
+	stop()
+	if rec := post(srv, "/api/traders/BTCUSDC/pause"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("stopped trader: status %d, want 503", rec.Code)
+	}
+}
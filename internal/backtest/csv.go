@@ -0,0 +1,135 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tick is a single replayed price observation.
+type Tick struct {
+	Symbol string
+	Time   time.Time
+	Price  float64
+}
+
+type bar struct {
+	time                   time.Time
+	open, high, low, close float64
+}
+
+// LoadCSV reads a price file for one symbol. Two supported layouts:
+//
+//   - ticks: time,price[,qty]
+//   - OHLCV: open_time,open,high,low,close,volume[,...] (Binance kline dumps)
+//
+// Times may be unix seconds, milliseconds, microseconds or RFC3339. A header
+// row is skipped. Each bar is expanded into four ticks (open, high/low, low/high,
+// close) spread across the bar so intrabar stops can trigger.
+func LoadCSV(symbol, path string) ([]Tick, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var ticks []Tick
+	var bars []bar
+	line := 0
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		line++
+
+		ts, err := ParseTime(rec[0])
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		switch {
+		case len(rec) >= 6:
+			var vals [4]float64
+			for i := range vals {
+				if vals[i], err = strconv.ParseFloat(rec[i+1], 64); err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+				}
+			}
+			bars = append(bars, bar{ts, vals[0], vals[1], vals[2], vals[3]})
+		case len(rec) >= 2:
+			price, err := strconv.ParseFloat(rec[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			ticks = append(ticks, Tick{Symbol: symbol, Time: ts, Price: price})
+		default:
+			return nil, fmt.Errorf("%s:%d: expected at least 2 columns", path, line)
+		}
+	}
+
+	ticks = append(ticks, expandBars(symbol, bars)...)
+
+	if len(ticks) == 0 {
+		return nil, fmt.Errorf("%s: no price rows", path)
+	}
+	return ticks, nil
+}
+
+// ParseTime accepts unix seconds, milliseconds, microseconds or RFC3339.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n > 1e15:
+			return time.UnixMicro(n), nil
+		case n > 1e12:
+			return time.UnixMilli(n), nil
+		default:
+			return time.Unix(n, 0), nil
+		}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// expandBars turns each bar into four ticks (open, high/low, low/high, close)
+// spread across the bar so intrabar stops can trigger.
+func expandBars(symbol string, bars []bar) []Tick {
+	var ticks []Tick
+	for i, b := range bars {
+		interval := time.Minute
+		if i+1 < len(bars) {
+			interval = bars[i+1].time.Sub(b.time)
+		} else if i > 0 {
+			interval = b.time.Sub(bars[i-1].time)
+		}
+		step := interval / 4
+		seq := []float64{b.open, b.low, b.high, b.close}
+		if b.close < b.open {
+			seq = []float64{b.open, b.high, b.low, b.close}
+		}
+		for j, p := range seq {
+			ticks = append(ticks, Tick{Symbol: symbol, Time: b.time.Add(time.Duration(j) * step), Price: p})
+		}
+	}
+	return ticks
+}
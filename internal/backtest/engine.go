@@ -0,0 +1,201 @@
+package backtest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"traderider/internal/clock"
+	"traderider/internal/exchange"
+	"traderider/internal/market"
+	"traderider/internal/notifier"
+	"traderider/internal/paper"
+	"traderider/internal/performance"
+	"traderider/internal/store"
+	"traderider/internal/trader"
+	"traderider/internal/wallet"
+)
+
+// TraderFactory builds a trader exactly as the live bot would, wired to the
+// simulated exchange, watcher, wallet and store.
+type TraderFactory func(symbol string, ex exchange.Exchange, mw *market.MarketWatcher, wm *wallet.WalletManager, db *store.Store) *trader.Trader
+
+type Options struct {
+	StartingBalance float64
+	CommissionRate  float64
+	Slippage        float64
+	// Spread is reported for every symbol; strategies reject wide spreads.
+	Spread float64
+	Filter exchange.SymbolFilter
+	// StepInterval is how often traders are evaluated in simulated time.
+	StepInterval time.Duration
+	// DBPath is where trades are recorded. Empty means a temporary file.
+	DBPath string
+}
+
+type Trade struct {
+	Symbol string    `json:"symbol"`
+	Side   string    `json:"side"`
+	Amount float64   `json:"amount"`
+	Price  float64   `json:"price"`
+	Time   time.Time `json:"time"`
+}
+
+type Result struct {
+	Start      time.Time                    `json:"start"`
+	End        time.Time                    `json:"end"`
+	Quote      string                       `json:"quote"` // asset the values are in
+	StartValue float64                      `json:"startValue"`
+	EndValue   float64                      `json:"endValue"`
+	Return     float64                      `json:"return"`
+	Trades     []Trade                      `json:"trades"`
+	Stats      map[string]performance.Stats `json:"stats"`
+}
+
+// Feed serves replayed prices to the paper exchange.
+type Feed struct {
+	mu     sync.RWMutex
+	prices map[string]float64
+	spread float64
+	filter exchange.SymbolFilter
+}
+
+func (f *Feed) GetSymbolPrice(symbol string) float64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.prices[symbol]
+}
+
+func (f *Feed) GetSpread(symbol string) float64 {
+	return f.spread
+}
+
+func (f *Feed) GetSymbolFilter(symbol string) exchange.SymbolFilter {
+	return f.filter
+}
+
+func (f *Feed) set(symbol string, price float64) {
+	f.mu.Lock()
+	f.prices[symbol] = price
+	f.mu.Unlock()
+}
+
+// Run replays ticks in time order through the trading loop and returns the
+// resulting trades and statistics.
+func Run(ticks []Tick, opts Options, newTrader TraderFactory) (*Result, error) {
+	if len(ticks) == 0 {
+		return nil, fmt.Errorf("no ticks to replay")
+	}
+	sort.SliceStable(ticks, func(i, j int) bool { return ticks[i].Time.Before(ticks[j].Time) })
+	if opts.StepInterval == 0 {
+		opts.StepInterval = 5 * time.Second
+	}
+
+	dbPath := opts.DBPath
+	if dbPath == "" {
+		dir, err := os.MkdirTemp("", "traderider-backtest")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		dbPath = filepath.Join(dir, "backtest.db")
+	}
+	db, err := store.NewStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.DB.Close()
+
+	clk := clock.NewSim(ticks[0].Time)
+	feed := &Feed{prices: make(map[string]float64), spread: opts.Spread, filter: opts.Filter}
+
+	// The result is valued in the one quote asset all symbols share, as the
+	// replay has no prices to convert between quotes.
+	var symbols []string
+	quote := ""
+	for _, tk := range ticks {
+		if contains(symbols, tk.Symbol) {
+			continue
+		}
+		_, q := exchange.Assets(feed, tk.Symbol)
+		if q == "" || (quote != "" && q != quote) {
+			return nil, fmt.Errorf("backtest symbols must share a known quote asset: %s", tk.Symbol)
+		}
+		quote = q
+		symbols = append(symbols, tk.Symbol)
+	}
+
+	ex := paper.NewExchange(feed, paper.Config{
+		StartingBalances: map[string]float64{quote: opts.StartingBalance},
+		CommissionRate:   opts.CommissionRate,
+		Slippage:         opts.Slippage,
+		Clock:            clk,
+	})
+	mw := market.NewWatcher(ex)
+	wm := wallet.NewWalletManager(ex, notifier.NewWhatsAppNotifier("", ""), quote)
+
+	traders := make(map[string]*trader.Trader)
+	lastStep := make(map[string]time.Time)
+	for _, symbol := range symbols {
+		tr := newTrader(symbol, ex, mw, wm, db)
+		tr.SetClock(clk)
+		traders[symbol] = tr
+	}
+
+	startValue := opts.StartingBalance
+	for _, tk := range ticks {
+		clk.Set(tk.Time)
+		feed.set(tk.Symbol, tk.Price)
+		ex.Match(tk.Symbol)
+		mw.Record(tk.Symbol, tk.Price, tk.Time)
+
+		if tk.Time.Sub(lastStep[tk.Symbol]) < opts.StepInterval {
+			continue
+		}
+		lastStep[tk.Symbol] = tk.Time
+		wm.Update()
+		traders[tk.Symbol].Tick()
+	}
+
+	res := &Result{
+		Start:      ticks[0].Time,
+		End:        ticks[len(ticks)-1].Time,
+		Quote:      quote,
+		StartValue: startValue,
+		Stats:      make(map[string]performance.Stats),
+	}
+	balances := ex.Balances()
+	res.EndValue = balances[quote]
+	for _, symbol := range symbols {
+		base, _ := exchange.Assets(feed, symbol)
+		res.EndValue += balances[base] * feed.GetSymbolPrice(symbol)
+
+		txs, err := db.GetAllTransactions(symbol)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range txs {
+			res.Trades = append(res.Trades, Trade{Symbol: symbol, Side: tx.Side, Amount: tx.Amount, Price: tx.Price, Time: tx.Time})
+		}
+		stats := performance.Compute(txs, opts.CommissionRate)
+		stats.Score = stats.RawScore()
+		res.Stats[symbol] = stats
+	}
+	sort.SliceStable(res.Trades, func(i, j int) bool { return res.Trades[i].Time.Before(res.Trades[j].Time) })
+	if startValue > 0 {
+		res.Return = (res.EndValue - startValue) / startValue
+	}
+	return res, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
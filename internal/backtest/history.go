@@ -0,0 +1,38 @@
+package backtest
+
+import (
+	"fmt"
+	"time"
+
+	"traderider/internal/store"
+)
+
+// LoadHistory reads a recorded window for one symbol from the bot's database.
+// One-second ticks are used when present; otherwise 1m candles are expanded
+// the same way as OHLCV CSV rows.
+func LoadHistory(db *store.Store, symbol string, from, to time.Time) ([]Tick, error) {
+	recorded, err := db.GetTicks(symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(recorded) > 0 {
+		ticks := make([]Tick, len(recorded))
+		for i, t := range recorded {
+			ticks[i] = Tick{Symbol: symbol, Time: t.Time, Price: t.Price}
+		}
+		return ticks, nil
+	}
+
+	candles, err := db.GetCandles(symbol, "1m", from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("%s: no recorded history between %s and %s", symbol, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	bars := make([]bar, len(candles))
+	for i, c := range candles {
+		bars[i] = bar{c.OpenTime, c.Open, c.High, c.Low, c.Close}
+	}
+	return expandBars(symbol, bars), nil
+}
@@ -4,56 +4,83 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math"
+	"net/http"
 	"strconv"
+	"sync"
+	"time"
+	"traderider/internal/exchange"
 	"traderider/internal/notifier"
 
 	binance "github.com/adshao/go-binance/v2"
 )
 
+var (
+	_ exchange.Exchange        = (*Client)(nil)
+	_ exchange.Streamer        = (*Client)(nil)
+	_ exchange.KlineSource     = (*Client)(nil)
+	_ exchange.LimitOrderer    = (*Client)(nil)
+	_ exchange.BookTicker      = (*Client)(nil)
+	_ exchange.StopOrderer     = (*Client)(nil)
+	_ exchange.OpenOrderLister = (*Client)(nil)
+	_ exchange.HealthReporter  = (*Client)(nil)
+	_ exchange.LockedBalancer  = (*Client)(nil)
+)
+
+// accountTTL is how long fetched balances are shared between callers.
+const accountTTL = 2 * time.Second
+
 type Client struct {
 	api           *binance.Client
-	symbolFilters map[string]SymbolFilter
+	filtersMu     sync.RWMutex
+	symbolFilters map[string]exchange.SymbolFilter
+	unknown       map[string]bool // symbols already reported as unlisted
 	notifier      *notifier.WhatsAppNotifier
-}
+	limiter       *limiter
+	testnet       bool
 
-type SymbolFilter struct {
-	MinQty      float64
-	StepSize    float64
-	MinNotional float64
+	accountMu  sync.Mutex
+	balances   map[string]float64 // free
+	locked     map[string]float64
+	balancesAt time.Time
+
+	// MaxClockDrift is the largest offset from server time at which orders
+	// are placed; defaults to DefaultMaxClockDrift.
+	MaxClockDrift time.Duration
+	timeMu        sync.Mutex
+	timeOffset    time.Duration
+	roundTrip     time.Duration
+	syncedAt      time.Time
+	timeErr       error
 }
 
-func NewClient(apiKey, secretKey string, notifier *notifier.WhatsAppNotifier) *Client {
+// NewClient connects to Binance Spot, or to the Spot testnet when testnet is
+// set. The library selects REST and websocket endpoints from a package-level
+// flag, so all clients in a process share one environment.
+func NewClient(apiKey, secretKey string, testnet bool, notifier *notifier.WhatsAppNotifier) *Client {
+	binance.UseTestnet = testnet
+	if testnet {
+		log.Printf("[TESTNET] Using the Binance Spot testnet at %s", binance.BaseAPITestnetURL)
+	}
 	c := binance.NewClient(apiKey, secretKey)
+	lim := newLimiter(c.HTTPClient.Transport)
+	c.HTTPClient = &http.Client{Transport: lim, Timeout: 15 * time.Second}
 	client := &Client{
 		api:           c,
-		symbolFilters: make(map[string]SymbolFilter),
+		symbolFilters: make(map[string]exchange.SymbolFilter),
+		unknown:       make(map[string]bool),
 		notifier:      notifier,
+		limiter:       lim,
+		testnet:       testnet,
+		MaxClockDrift: DefaultMaxClockDrift,
 	}
-	client.loadSymbolFilters()
-	return client
-}
-
-func (c *Client) loadSymbolFilters() {
-	info, err := c.api.NewExchangeInfoService().Do(context.Background())
-	if err != nil {
+	if err := client.syncTime(); err != nil {
+		log.Printf("[ERROR] Failed to sync with Binance server time: %v", err)
+	}
+	if err := client.loadSymbolFilters(); err != nil {
 		log.Printf("[ERROR] Failed to load exchange info: %v", err)
-		c.notifier.Send(fmt.Sprintf("[ERROR] Failed to load exchange info: %v", err))
-		return
-	}
-	for _, sym := range info.Symbols {
-		var minQty, stepSize, minNotional float64
-		for _, filter := range sym.Filters {
-			switch filter["filterType"] {
-			case "LOT_SIZE":
-				minQty, _ = strconv.ParseFloat(filter["minQty"].(string), 64)
-				stepSize, _ = strconv.ParseFloat(filter["stepSize"].(string), 64)
-			case "NOTIONAL":
-				minNotional, _ = strconv.ParseFloat(filter["minNotional"].(string), 64)
-			}
-		}
-		c.symbolFilters[sym.Symbol] = SymbolFilter{MinQty: minQty, StepSize: stepSize, MinNotional: minNotional}
+		notifier.Send(fmt.Sprintf("[ERROR] Failed to load exchange info: %v", err))
 	}
+	return client
 }
 
 func (c *Client) GetSymbolPrice(symbol string) float64 {
@@ -78,98 +105,421 @@ func (c *Client) GetSpread(symbol string) float64 {
 	return (ask - bid) / bid
 }
 
-func (c *Client) GetAssetBalance(asset string) (float64, error) {
-	account, err := c.api.NewGetAccountService().Do(context.Background())
+// StreamQuotes subscribes to the bookTicker and aggTrade streams for symbols.
+func (c *Client) StreamQuotes(symbols []string, handler func(exchange.Quote), errHandler func(error)) (<-chan struct{}, func(), error) {
+	bookDone, bookStop, err := binance.WsCombinedBookTickerServe(symbols, func(e *binance.WsBookTickerEvent) {
+		bid, _ := strconv.ParseFloat(e.BestBidPrice, 64)
+		ask, _ := strconv.ParseFloat(e.BestAskPrice, 64)
+		handler(exchange.Quote{Symbol: e.Symbol, Bid: bid, Ask: ask, Time: time.Now()})
+	}, errHandler)
 	if err != nil {
-		log.Printf("[ERROR] Binance account error: %v", err)
-		c.notifier.Send(fmt.Sprintf("[ERROR] Binance account error: %v", err))
-		return 0, err
+		return nil, nil, err
 	}
-	for _, b := range account.Balances {
-		if b.Asset == asset {
-			return strconv.ParseFloat(b.Free, 64)
-		}
+	tradeDone, tradeStop, err := binance.WsCombinedAggTradeServe(symbols, func(e *binance.WsAggTradeEvent) {
+		price, _ := strconv.ParseFloat(e.Price, 64)
+		qty, _ := strconv.ParseFloat(e.Quantity, 64)
+		handler(exchange.Quote{Symbol: e.Symbol, Price: price, Qty: qty, Time: time.UnixMilli(e.TradeTime)})
+	}, errHandler)
+	if err != nil {
+		close(bookStop)
+		return nil, nil, err
 	}
-	return 0, nil
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(bookStop)
+			close(tradeStop)
+		})
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-bookDone:
+		case <-tradeDone:
+		}
+		stop()
+		<-bookDone
+		<-tradeDone
+		close(done)
+	}()
+	return done, stop, nil
 }
 
-func (c *Client) GetUSDCBalance() (float64, error) {
-	return c.GetAssetBalance("USDC")
+func (c *Client) GetBookTicker(symbol string) (float64, float64, error) {
+	res, err := c.api.NewListBookTickersService().Symbol(symbol).Do(context.Background())
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(res) == 0 {
+		return 0, 0, fmt.Errorf("no book ticker for %s", symbol)
+	}
+	bid, _ := strconv.ParseFloat(res[0].BidPrice, 64)
+	ask, _ := strconv.ParseFloat(res[0].AskPrice, 64)
+	return bid, ask, nil
 }
 
-func (c *Client) adjustQuantity(symbol string, quantity float64) float64 {
-	filter := c.GetSymbolFilter(symbol)
-	if filter.StepSize == 0 {
-		return quantity
+func (c *Client) GetKlines(symbol, interval string, limit int) ([]exchange.Kline, error) {
+	res, err := c.api.NewKlinesService().Symbol(symbol).Interval(interval).Limit(limit).Do(context.Background())
+	if err != nil {
+		return nil, err
 	}
-	steps := math.Floor(quantity / filter.StepSize)
-	adj := steps * filter.StepSize
-	if adj < filter.MinQty {
-		log.Printf("[ADJUST] Quantity %.8f < MinQty %.8f", adj, filter.MinQty)
+	klines := make([]exchange.Kline, 0, len(res))
+	for _, k := range res {
+		kl := exchange.Kline{OpenTime: time.UnixMilli(k.OpenTime)}
+		kl.Open, _ = strconv.ParseFloat(k.Open, 64)
+		kl.High, _ = strconv.ParseFloat(k.High, 64)
+		kl.Low, _ = strconv.ParseFloat(k.Low, 64)
+		kl.Close, _ = strconv.ParseFloat(k.Close, 64)
+		kl.Volume, _ = strconv.ParseFloat(k.Volume, 64)
+		klines = append(klines, kl)
 	}
-	return adj
+	return klines, nil
 }
 
-func (c *Client) GetSymbolFilter(symbol string) SymbolFilter {
-	if filter, ok := c.symbolFilters[symbol]; ok {
-		return filter
+// GetAssetBalance returns the free balance of asset. Balances are fetched
+// for the whole account at once and shared for accountTTL, or until an
+// order changes them.
+func (c *Client) GetAssetBalance(asset string) (float64, error) {
+	free, _, err := c.balance(asset)
+	return free, err
+}
+
+// GetLockedBalance returns the part of asset's balance held by open orders.
+func (c *Client) GetLockedBalance(asset string) (float64, error) {
+	_, locked, err := c.balance(asset)
+	return locked, err
+}
+
+func (c *Client) balance(asset string) (free, locked float64, err error) {
+	c.accountMu.Lock()
+	defer c.accountMu.Unlock()
+	if c.balances == nil || time.Since(c.balancesAt) > accountTTL {
+		account, err := c.signed().NewGetAccountService().Do(context.Background())
+		if err != nil {
+			log.Printf("[ERROR] Binance account error: %v", err)
+			c.notifier.Send(fmt.Sprintf("[ERROR] Binance account error: %v", err))
+			return 0, 0, err
+		}
+		c.balances = make(map[string]float64, len(account.Balances))
+		c.locked = make(map[string]float64, len(account.Balances))
+		for _, b := range account.Balances {
+			c.balances[b.Asset], _ = strconv.ParseFloat(b.Free, 64)
+			c.locked[b.Asset], _ = strconv.ParseFloat(b.Locked, 64)
+		}
+		c.balancesAt = time.Now()
 	}
-	return SymbolFilter{MinQty: 0.00001, StepSize: 0.00000001, MinNotional: 10.0}
+	return c.balances[asset], c.locked[asset], nil
+}
+
+// Testnet reports whether the client trades on the Spot testnet.
+func (c *Client) Testnet() bool {
+	return c.testnet
 }
 
-func (c *Client) MarketBuy(symbol string, quantity float64) (float64, error) {
-	quantity = c.adjustQuantity(symbol, quantity)
-	if quantity <= 0 {
-		return 0, fmt.Errorf("invalid quantity for MarketBuy: %s", symbol)
+// invalidateBalances makes the next balance read fetch the account again.
+func (c *Client) invalidateBalances() {
+	c.accountMu.Lock()
+	c.balances = nil
+	c.accountMu.Unlock()
+}
+
+// UsedWeight returns the request weight used in the current minute and the
+// limit it is throttled against.
+func (c *Client) UsedWeight() (int64, int64) {
+	return c.limiter.usage()
+}
+
+func (c *Client) MarketBuy(symbol string, quantity float64) (*exchange.Order, error) {
+	if err := c.checkClock(); err != nil {
+		return nil, err
+	}
+	quantity = c.adjustQuantity(symbol, quantity, true)
+	err := c.validate(exchange.OrderCheck{Symbol: symbol, Side: exchange.SideBuy, Type: exchange.OrderTypeMarket, Quantity: quantity})
+	if err != nil {
+		return nil, err
 	}
-	order, err := c.api.NewCreateOrderService().Symbol(symbol).Side(binance.SideTypeBuy).
+	defer c.invalidateBalances()
+	order, err := c.signed().NewCreateOrderService().Symbol(symbol).Side(binance.SideTypeBuy).
 		Type(binance.OrderTypeMarket).Quantity(fmt.Sprintf("%.8f", quantity)).Do(context.Background())
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return parseFillPrice(order.Fills)
+	return parseOrder(order)
 }
 
-func (c *Client) MarketSell(symbol string, quantity float64) (float64, error) {
-	quantity = c.adjustQuantity(symbol, quantity)
-	if quantity <= 0 {
-		return 0, fmt.Errorf("invalid quantity for MarketSell: %s", symbol)
+func (c *Client) MarketSell(symbol string, quantity float64) (*exchange.Order, error) {
+	if err := c.checkClock(); err != nil {
+		return nil, err
 	}
-	order, err := c.api.NewCreateOrderService().Symbol(symbol).Side(binance.SideTypeSell).
+	quantity = c.adjustQuantity(symbol, quantity, true)
+	err := c.validate(exchange.OrderCheck{Symbol: symbol, Side: exchange.SideSell, Type: exchange.OrderTypeMarket, Quantity: quantity})
+	if err != nil {
+		return nil, err
+	}
+	defer c.invalidateBalances()
+	order, err := c.signed().NewCreateOrderService().Symbol(symbol).Side(binance.SideTypeSell).
 		Type(binance.OrderTypeMarket).Quantity(fmt.Sprintf("%.8f", quantity)).Do(context.Background())
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	return parseOrder(order)
+}
+
+// LimitOrder places a GTC LIMIT order, or a LIMIT_MAKER order when postOnly.
+func (c *Client) LimitOrder(symbol, side string, quantity, price float64, postOnly bool) (*exchange.Order, error) {
+	if err := c.checkClock(); err != nil {
+		return nil, err
+	}
+	quantity = c.adjustQuantity(symbol, quantity, false)
+	price = c.GetSymbolFilter(symbol).FloorPrice(price)
+	typ := exchange.OrderTypeLimit
+	if postOnly {
+		typ = exchange.OrderTypeLimitMaker
+	}
+	err := c.validate(exchange.OrderCheck{Symbol: symbol, Side: side, Type: typ, Quantity: quantity, Price: price})
+	if err == nil {
+		err = c.checkOrderCount(symbol, 1, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer c.invalidateBalances()
+	svc := c.signed().NewCreateOrderService().Symbol(symbol).Side(binance.SideType(side)).
+		Quantity(formatFloat(quantity)).Price(formatFloat(price))
+	if postOnly {
+		svc = svc.Type(binance.OrderTypeLimitMaker)
+	} else {
+		svc = svc.Type(binance.OrderTypeLimit).TimeInForce(binance.TimeInForceTypeGTC)
+	}
+	res, err := svc.Do(context.Background())
+	if err != nil {
+		return nil, err
 	}
-	return parseFillPrice(order.Fills)
+	return toOrder(res), nil
 }
 
-func parseFillPrice(fills []*binance.Fill) (float64, error) {
-	totalPrice, totalQty := 0.0, 0.0
-	for _, f := range fills {
-		price, _ := strconv.ParseFloat(f.Price, 64)
-		qty, _ := strconv.ParseFloat(f.Quantity, 64)
-		totalPrice += price * qty
-		totalQty += qty
+// GetOrder queries an order and, if anything executed, its trades.
+func (c *Client) GetOrder(symbol string, orderID int64) (*exchange.Order, error) {
+	res, err := c.signed().NewGetOrderService().Symbol(symbol).OrderID(orderID).Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	order := fromOrder(res)
+	return order, c.loadFills(order)
+}
+
+func (c *Client) GetOpenOrders(symbol string) ([]*exchange.Order, error) {
+	res, err := c.signed().NewListOpenOrdersService().Symbol(symbol).Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	orders := make([]*exchange.Order, len(res))
+	for i, o := range res {
+		orders[i] = fromOrder(o)
+	}
+	return orders, nil
+}
+
+func fromOrder(res *binance.Order) *exchange.Order {
+	order := &exchange.Order{
+		Symbol:        res.Symbol,
+		OrderID:       res.OrderID,
+		ClientOrderID: res.ClientOrderID,
+		OrderListID:   res.OrderListId,
+		Side:          string(res.Side),
+		Type:          string(res.Type),
+		Status:        string(res.Status),
+		Time:          time.UnixMilli(res.UpdateTime),
+	}
+	order.Price, _ = strconv.ParseFloat(res.Price, 64)
+	order.StopPrice, _ = strconv.ParseFloat(res.StopPrice, 64)
+	order.OrigQty, _ = strconv.ParseFloat(res.OrigQuantity, 64)
+	order.ExecutedQty, _ = strconv.ParseFloat(res.ExecutedQuantity, 64)
+	order.QuoteQty, _ = strconv.ParseFloat(res.CummulativeQuoteQuantity, 64)
+	return order
+}
+
+// CancelOrder cancels an order and returns its final state with any fills.
+func (c *Client) CancelOrder(symbol string, orderID int64) (*exchange.Order, error) {
+	defer c.invalidateBalances()
+	res, err := c.signed().NewCancelOrderService().Symbol(symbol).OrderID(orderID).Do(context.Background())
+	if err != nil {
+		return nil, err
 	}
-	if totalQty == 0 {
-		return 0, fmt.Errorf("empty fills")
+	order := &exchange.Order{
+		Symbol:  res.Symbol,
+		OrderID: res.OrderID,
+		Side:    string(res.Side),
+		Type:    string(res.Type),
+		Status:  string(res.Status),
+		Time:    time.UnixMilli(res.TransactTime),
 	}
-	return totalPrice / totalQty, nil
+	order.OrderListID = res.OrderListID
+	order.ClientOrderID = res.OrigClientOrderID
+	order.Price, _ = strconv.ParseFloat(res.Price, 64)
+	order.OrigQty, _ = strconv.ParseFloat(res.OrigQuantity, 64)
+	order.ExecutedQty, _ = strconv.ParseFloat(res.ExecutedQuantity, 64)
+	order.QuoteQty, _ = strconv.ParseFloat(res.CummulativeQuoteQuantity, 64)
+	return order, c.loadFills(order)
 }
 
-func (c *Client) CalculateBuyQty(symbol string, availableUSDC float64) (float64, error) {
+// StopLossLimit places a GTC STOP_LOSS_LIMIT sell.
+func (c *Client) StopLossLimit(symbol string, quantity, stopPrice, limitPrice float64) (*exchange.Order, error) {
+	if err := c.checkClock(); err != nil {
+		return nil, err
+	}
+	filter := c.GetSymbolFilter(symbol)
+	quantity = c.adjustQuantity(symbol, quantity, false)
+	stopPrice, limitPrice = filter.FloorPrice(stopPrice), filter.FloorPrice(limitPrice)
+	err := c.validate(exchange.OrderCheck{Symbol: symbol, Side: exchange.SideSell, Type: exchange.OrderTypeStopLoss,
+		Quantity: quantity, Price: limitPrice, StopPrice: stopPrice})
+	if err == nil {
+		err = c.checkOrderCount(symbol, 1, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer c.invalidateBalances()
+	res, err := c.signed().NewCreateOrderService().Symbol(symbol).Side(binance.SideTypeSell).
+		Type(binance.OrderTypeStopLossLimit).TimeInForce(binance.TimeInForceTypeGTC).
+		Quantity(formatFloat(quantity)).Price(formatFloat(limitPrice)).StopPrice(formatFloat(stopPrice)).
+		Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	order := toOrder(res)
+	order.StopPrice = stopPrice
+	return order, nil
+}
+
+// PlaceOCO places a sell OCO: a LIMIT_MAKER take-profit and a STOP_LOSS_LIMIT.
+func (c *Client) PlaceOCO(symbol string, quantity, takeProfit, stopPrice, stopLimitPrice float64) ([]*exchange.Order, error) {
+	if err := c.checkClock(); err != nil {
+		return nil, err
+	}
+	filter := c.GetSymbolFilter(symbol)
+	quantity = c.adjustQuantity(symbol, quantity, false)
+	takeProfit, stopPrice, stopLimitPrice = filter.FloorPrice(takeProfit), filter.FloorPrice(stopPrice), filter.FloorPrice(stopLimitPrice)
+	if takeProfit <= stopPrice {
+		return nil, &exchange.FilterError{Symbol: symbol, Filter: "OCO", Reason: fmt.Sprintf("take-profit %.8f not above stop %.8f", takeProfit, stopPrice)}
+	}
+	err := c.validate(exchange.OrderCheck{Symbol: symbol, Side: exchange.SideSell, Type: exchange.OrderTypeLimitMaker,
+		Quantity: quantity, Price: takeProfit})
+	if err == nil {
+		err = c.validate(exchange.OrderCheck{Symbol: symbol, Side: exchange.SideSell, Type: exchange.OrderTypeStopLoss,
+			Quantity: quantity, Price: stopLimitPrice, StopPrice: stopPrice})
+	}
+	if err == nil {
+		err = c.checkOrderCount(symbol, 2, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer c.invalidateBalances()
+	res, err := c.signed().NewCreateOCOService().Symbol(symbol).Side(binance.SideTypeSell).
+		Quantity(formatFloat(quantity)).Price(formatFloat(takeProfit)).
+		StopPrice(formatFloat(stopPrice)).StopLimitPrice(formatFloat(stopLimitPrice)).
+		StopLimitTimeInForce(binance.TimeInForceTypeGTC).Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	legs := make([]*exchange.Order, 0, len(res.OrderReports))
+	for _, r := range res.OrderReports {
+		order := &exchange.Order{
+			Symbol:        r.Symbol,
+			OrderID:       r.OrderID,
+			Side:          string(r.Side),
+			Type:          string(r.Type),
+			Status:        string(r.Status),
+			Time:          time.UnixMilli(r.TransactionTime),
+			OrderListID:   r.OrderListID,
+			ClientOrderID: r.ClientOrderID,
+		}
+		order.Price, _ = strconv.ParseFloat(r.Price, 64)
+		order.StopPrice, _ = strconv.ParseFloat(r.StopPrice, 64)
+		order.OrigQty, _ = strconv.ParseFloat(r.OrigQuantity, 64)
+		order.ExecutedQty, _ = strconv.ParseFloat(r.ExecutedQuantity, 64)
+		order.QuoteQty, _ = strconv.ParseFloat(r.CummulativeQuoteQuantity, 64)
+		legs = append(legs, order)
+	}
+	return legs, nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// loadFills attaches the account trades of a (partially) executed order,
+// which the order query endpoints do not return.
+func (c *Client) loadFills(order *exchange.Order) error {
+	if order.ExecutedQty == 0 {
+		return nil
+	}
+	trades, err := c.signed().NewListTradesService().Symbol(order.Symbol).OrderId(order.OrderID).Do(context.Background())
+	if err != nil {
+		return err
+	}
+	order.Fills = order.Fills[:0]
+	for _, t := range trades {
+		fill := exchange.Fill{TradeID: t.ID, CommissionAsset: t.CommissionAsset}
+		fill.Price, _ = strconv.ParseFloat(t.Price, 64)
+		fill.Qty, _ = strconv.ParseFloat(t.Quantity, 64)
+		fill.Commission, _ = strconv.ParseFloat(t.Commission, 64)
+		order.Fills = append(order.Fills, fill)
+	}
+	return nil
+}
+
+func parseOrder(res *binance.CreateOrderResponse) (*exchange.Order, error) {
+	order := toOrder(res)
+	if order.AvgPrice() == 0 {
+		return order, fmt.Errorf("empty fills")
+	}
+	return order, nil
+}
+
+func toOrder(res *binance.CreateOrderResponse) *exchange.Order {
+	order := &exchange.Order{
+		Symbol:        res.Symbol,
+		OrderID:       res.OrderID,
+		ClientOrderID: res.ClientOrderID,
+		Side:          string(res.Side),
+		Type:          string(res.Type),
+		Status:        string(res.Status),
+		Time:          time.UnixMilli(res.TransactTime),
+	}
+	order.Price, _ = strconv.ParseFloat(res.Price, 64)
+	order.OrigQty, _ = strconv.ParseFloat(res.OrigQuantity, 64)
+	order.ExecutedQty, _ = strconv.ParseFloat(res.ExecutedQuantity, 64)
+	order.QuoteQty, _ = strconv.ParseFloat(res.CummulativeQuoteQuantity, 64)
+	for _, f := range res.Fills {
+		fill := exchange.Fill{TradeID: f.TradeID, CommissionAsset: f.CommissionAsset}
+		fill.Price, _ = strconv.ParseFloat(f.Price, 64)
+		fill.Qty, _ = strconv.ParseFloat(f.Quantity, 64)
+		fill.Commission, _ = strconv.ParseFloat(f.Commission, 64)
+		order.Fills = append(order.Fills, fill)
+	}
+	return order
+}
+
+func (c *Client) CalculateBuyQty(symbol string, available float64) (float64, error) {
 	price := c.GetSymbolPrice(symbol)
 	if price == 0 {
 		return 0, fmt.Errorf("price unavailable")
 	}
 	filter := c.GetSymbolFilter(symbol)
 	minQty := filter.MinNotional / price
-	minQty = c.adjustQuantity(symbol, minQty)
-	if availableUSDC < minQty*price {
-		return 0, fmt.Errorf("not enough USDC")
+	minQty = c.adjustQuantity(symbol, minQty, true)
+	if available < minQty*price {
+		_, quote := exchange.Assets(c, symbol)
+		return 0, fmt.Errorf("not enough %s", quote)
+	}
+	qty := available / price
+	qty = c.adjustQuantity(symbol, qty, true)
+	if filter.MarketMaxQty > 0 && qty > filter.MarketMaxQty {
+		qty = filter.MarketMaxQty
 	}
-	qty := availableUSDC / price
-	qty = c.adjustQuantity(symbol, qty)
 	if qty*price < filter.MinNotional {
 		return 0, fmt.Errorf("notional too low")
 	}
@@ -177,6 +527,8 @@ func (c *Client) CalculateBuyQty(symbol string, availableUSDC float64) (float64,
 }
 
 func (c *Client) DebugPrintFilters() {
+	c.filtersMu.RLock()
+	defer c.filtersMu.RUnlock()
 	for symbol, filter := range c.symbolFilters {
 		fmt.Printf("%s → minQty=%.8f, stepSize=%.8f, minNotional=%.2f\n",
 			symbol, filter.MinQty, filter.StepSize, filter.MinNotional)
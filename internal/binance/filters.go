@@ -0,0 +1,196 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"traderider/internal/exchange"
+)
+
+// loadSymbolFilters fetches the exchange info and replaces the trading rules
+// of every symbol. On error the previous rules are kept.
+func (c *Client) loadSymbolFilters() error {
+	info, err := c.api.NewExchangeInfoService().Do(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(info.Symbols) == 0 {
+		return errors.New("exchange info lists no symbols")
+	}
+	for _, rl := range info.RateLimits {
+		if rl.RateLimitType == "REQUEST_WEIGHT" && rl.Interval == "MINUTE" && rl.IntervalNum == 1 {
+			c.limiter.setLimit(rl.Limit)
+		}
+	}
+	filters := make(map[string]exchange.SymbolFilter, len(info.Symbols))
+	for _, sym := range info.Symbols {
+		f := exchange.SymbolFilter{Status: sym.Status, BaseAsset: sym.BaseAsset, QuoteAsset: sym.QuoteAsset}
+		for _, filter := range sym.Filters {
+			switch filter["filterType"] {
+			case "PRICE_FILTER":
+				f.TickSize = number(filter["tickSize"])
+				f.MinPrice = number(filter["minPrice"])
+				f.MaxPrice = number(filter["maxPrice"])
+			case "LOT_SIZE":
+				f.MinQty = number(filter["minQty"])
+				f.MaxQty = number(filter["maxQty"])
+				f.StepSize = number(filter["stepSize"])
+			case "MARKET_LOT_SIZE":
+				f.MarketMinQty = number(filter["minQty"])
+				f.MarketMaxQty = number(filter["maxQty"])
+				f.MarketStepSize = number(filter["stepSize"])
+			case "NOTIONAL":
+				f.MinNotional = number(filter["minNotional"])
+				f.MaxNotional = number(filter["maxNotional"])
+				f.ApplyMinToMarket, _ = filter["applyMinToMarket"].(bool)
+				f.ApplyMaxToMarket, _ = filter["applyMaxToMarket"].(bool)
+			case "MIN_NOTIONAL":
+				f.MinNotional = number(filter["minNotional"])
+				f.ApplyMinToMarket, _ = filter["applyToMarket"].(bool)
+			case "PERCENT_PRICE":
+				f.BidMultiplierUp = number(filter["multiplierUp"])
+				f.BidMultiplierDown = number(filter["multiplierDown"])
+				f.AskMultiplierUp, f.AskMultiplierDown = f.BidMultiplierUp, f.BidMultiplierDown
+			case "PERCENT_PRICE_BY_SIDE":
+				f.BidMultiplierUp = number(filter["bidMultiplierUp"])
+				f.BidMultiplierDown = number(filter["bidMultiplierDown"])
+				f.AskMultiplierUp = number(filter["askMultiplierUp"])
+				f.AskMultiplierDown = number(filter["askMultiplierDown"])
+			case "MAX_NUM_ORDERS":
+				f.MaxNumOrders = int(number(filter["maxNumOrders"]))
+			case "MAX_NUM_ALGO_ORDERS":
+				f.MaxNumAlgoOrders = int(number(filter["maxNumAlgoOrders"]))
+			}
+		}
+		filters[sym.Symbol] = f
+	}
+
+	c.filtersMu.Lock()
+	c.symbolFilters = filters
+	c.filtersMu.Unlock()
+	return nil
+}
+
+// number reads a filter value, which Binance sends as a decimal string or
+// a JSON number.
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// RefreshFilters reloads the trading rules every interval until ctx is
+// done, so changed tick sizes, limits and halted symbols are picked up while
+// running. Until a load succeeds every order is refused, so failures are
+// retried sooner.
+func (c *Client) RefreshFilters(ctx context.Context, interval time.Duration) {
+	c.filtersMu.RLock()
+	loaded := len(c.symbolFilters) > 0
+	c.filtersMu.RUnlock()
+	poll(ctx, interval, !loaded, func() error {
+		if err := c.loadSymbolFilters(); err != nil {
+			log.Printf("[ERROR] Failed to refresh exchange info: %v", err)
+			return err
+		}
+		log.Printf("[FILTERS] Refreshed trading rules")
+		return nil
+	})
+}
+
+// pollRetryMin is the first delay before a failed poll is retried.
+const pollRetryMin = 5 * time.Second
+
+// poll calls fn every interval until ctx is done. After a failure, or from
+// the start when failing is set, fn is retried after pollRetryMin, doubling
+// up to interval.
+func poll(ctx context.Context, interval time.Duration, failing bool, fn func() error) {
+	retry := pollRetryMin
+	next := func(failed bool) time.Duration {
+		if !failed {
+			retry = pollRetryMin
+			return interval
+		}
+		wait := min(retry, interval)
+		retry = min(retry*2, interval)
+		return wait
+	}
+	timer := time.NewTimer(next(failing))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		timer.Reset(next(fn() != nil))
+	}
+}
+
+// GetSymbolFilter returns the trading rules of symbol, or no rules for a
+// symbol the exchange does not list; orders on it are refused.
+func (c *Client) GetSymbolFilter(symbol string) exchange.SymbolFilter {
+	filter, _ := c.symbolFilter(symbol)
+	return filter
+}
+
+func (c *Client) symbolFilter(symbol string) (exchange.SymbolFilter, bool) {
+	c.filtersMu.RLock()
+	filter, ok := c.symbolFilters[symbol]
+	c.filtersMu.RUnlock()
+	if !ok {
+		c.filtersMu.Lock()
+		if !c.unknown[symbol] {
+			c.unknown[symbol] = true
+			log.Printf("[FILTERS] No trading rules for %s", symbol)
+		}
+		c.filtersMu.Unlock()
+	}
+	return filter, ok
+}
+
+// adjustQuantity rounds a quantity down to the symbol's step for market or
+// other orders.
+func (c *Client) adjustQuantity(symbol string, quantity float64, market bool) float64 {
+	return c.GetSymbolFilter(symbol).FloorQty(quantity, market)
+}
+
+// validate checks an order against the symbol's rules before it is sent,
+// valuing it at the current price.
+func (c *Client) validate(o exchange.OrderCheck) error {
+	filter, ok := c.symbolFilter(o.Symbol)
+	if !ok {
+		return fmt.Errorf("%w: %s", exchange.ErrUnknownSymbol, o.Symbol)
+	}
+	o.MarketPrice = c.GetSymbolPrice(o.Symbol)
+	return filter.Check(o)
+}
+
+// checkOrderCount fetches the symbol's open orders and checks that placing
+// orders more, of which algo are stop orders, stays within its
+// MAX_NUM_ORDERS and MAX_NUM_ALGO_ORDERS limits.
+func (c *Client) checkOrderCount(symbol string, orders, algo int) error {
+	filter := c.GetSymbolFilter(symbol)
+	if filter.MaxNumOrders == 0 && filter.MaxNumAlgoOrders == 0 {
+		return nil
+	}
+	open, err := c.GetOpenOrders(symbol)
+	if err != nil {
+		return err
+	}
+	openAlgo := 0
+	for _, o := range open {
+		if exchange.IsAlgoOrder(o.Type) {
+			openAlgo++
+		}
+	}
+	return filter.CheckOrderCount(symbol, len(open), openAlgo, orders, algo)
+}
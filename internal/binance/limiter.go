@@ -0,0 +1,191 @@
+package binance
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWeightLimit = 6000
+	// weightHeadroom is the share of the minute's weight the bot uses,
+	// leaving room for other clients on the same IP.
+	weightHeadroom = 0.8
+	maxRetries     = 3
+	retryBackoff   = 500 * time.Millisecond
+	// maxBackoffWait is the longest a request waits out a 429/418 back-off;
+	// beyond that it fails instead of stalling the trading loop.
+	maxBackoffWait = 30 * time.Second
+)
+
+// endpointWeights are the request weights of the endpoints the client uses;
+// anything else counts as 1.
+var endpointWeights = map[string]int64{
+	"/api/v3/account":           20,
+	"/api/v3/exchangeInfo":      20,
+	"/api/v3/myTrades":          20,
+	"/api/v3/openOrders":        6,
+	"/api/v3/depth":             5,
+	"/api/v3/ticker/price":      2,
+	"/api/v3/ticker/bookTicker": 2,
+	"/api/v3/klines":            2,
+}
+
+func requestWeight(req *http.Request) int64 {
+	if req.Method == http.MethodGet && req.URL.Path == "/api/v3/order" {
+		return 4
+	}
+	if w, ok := endpointWeights[req.URL.Path]; ok {
+		return w
+	}
+	return 1
+}
+
+// limiter is an http.RoundTripper that keeps the client under Binance's
+// request weight limit. Requests queue until the current minute has room
+// for their weight, using the X-MBX-USED-WEIGHT-1M header the exchange
+// returns; 429 and 418 responses stop all requests for their Retry-After.
+// Reads that fail with a network, rate limit or server error are retried
+// with backoff.
+type limiter struct {
+	next http.RoundTripper
+
+	queue sync.Mutex // held while a request waits for room
+
+	mu           sync.Mutex
+	limit        int64
+	used         int64
+	window       time.Time
+	backoffUntil time.Time
+}
+
+func newLimiter(next http.RoundTripper) *limiter {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &limiter{next: next, limit: defaultWeightLimit}
+}
+
+// setLimit applies the REQUEST_WEIGHT limit from the exchange info.
+func (l *limiter) setLimit(limit int64) {
+	if limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	l.limit = limit
+	l.mu.Unlock()
+}
+
+// usage returns the weight used in the current minute and the limit.
+func (l *limiter) usage() (int64, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.window.Equal(time.Now().Truncate(time.Minute)) {
+		return 0, l.limit
+	}
+	return l.used, l.limit
+}
+
+func (l *limiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	weight := requestWeight(req)
+	for attempt := 0; ; attempt++ {
+		if err := l.acquire(req, weight); err != nil {
+			return nil, err
+		}
+		res, err := l.next.RoundTrip(req)
+		if err == nil {
+			l.observe(res)
+		}
+		// Only reads are resent: an order that timed out may still have
+		// been placed.
+		if req.Method != http.MethodGet || attempt >= maxRetries || !transient(res, err) {
+			return res, err
+		}
+
+		wait := retryBackoff << attempt
+		if err != nil {
+			log.Printf("[RATELIMIT] %s failed: %v; retry %d in %s", req.URL.Path, err, attempt+1, wait)
+		} else {
+			log.Printf("[RATELIMIT] %s returned %d; retry %d in %s", req.URL.Path, res.StatusCode, attempt+1, wait)
+			res.Body.Close()
+		}
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// transient reports whether a request failed in a way worth retrying: a
+// network error, rate limiting or a server error.
+func transient(res *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		return errors.As(err, &netErr)
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// acquire waits until a back-off has passed and the current minute has room
+// for weight, then reserves it.
+func (l *limiter) acquire(req *http.Request, weight int64) error {
+	l.queue.Lock()
+	defer l.queue.Unlock()
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if minute := now.Truncate(time.Minute); !l.window.Equal(minute) {
+			l.window, l.used = minute, 0
+		}
+		var wait time.Duration
+		switch {
+		case now.Before(l.backoffUntil):
+			wait = l.backoffUntil.Sub(now)
+			if wait > maxBackoffWait {
+				l.mu.Unlock()
+				return fmt.Errorf("binance rate limit: requests suspended until %s", l.backoffUntil.Format(time.RFC3339))
+			}
+		case float64(l.used+weight) > float64(l.limit)*weightHeadroom && l.used > 0:
+			wait = l.window.Add(time.Minute).Sub(now)
+			log.Printf("[RATELIMIT] Used weight %d/%d; waiting %s for %s", l.used, l.limit, wait.Round(time.Millisecond), req.URL.Path)
+		default:
+			l.used += weight
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return req.Context().Err()
+		}
+	}
+}
+
+// observe takes the used weight from a response and starts a back-off on
+// 429 (too many requests) and 418 (IP banned).
+func (l *limiter) observe(res *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if used, err := strconv.ParseInt(res.Header.Get("X-Mbx-Used-Weight-1m"), 10, 64); err == nil {
+		l.window, l.used = time.Now().Truncate(time.Minute), used
+	}
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusTeapot {
+		return
+	}
+	wait := time.Minute
+	if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && s > 0 {
+		wait = time.Duration(s) * time.Second
+	}
+	if until := time.Now().Add(wait); until.After(l.backoffUntil) {
+		l.backoffUntil = until
+	}
+	log.Printf("[RATELIMIT] Binance returned %d; backing off for %s", res.StatusCode, wait)
+}
@@ -0,0 +1,128 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	binance "github.com/adshao/go-binance/v2"
+
+	"traderider/internal/exchange"
+)
+
+// DefaultMaxClockDrift is the largest offset from Binance's clock at which
+// orders are still placed. Binance rejects requests stamped more than 1s
+// ahead or older than the 5s receive window.
+const DefaultMaxClockDrift = 5 * time.Second
+
+// ErrClockDrift is returned for orders refused because the clock offset is
+// unknown or too large.
+var ErrClockDrift = errors.New("clock drift")
+
+// syncTime measures the offset between the local clock and Binance's,
+// assuming the server read its clock halfway through the round trip. Signed
+// requests pick it up through signed.
+func (c *Client) syncTime() error {
+	start := time.Now()
+	serverMs, err := c.api.NewServerTimeService().Do(context.Background())
+	end := time.Now()
+
+	c.timeMu.Lock()
+	defer c.timeMu.Unlock()
+	if err != nil {
+		c.timeErr = err
+		return err
+	}
+	roundTrip := end.Sub(start)
+	local := start.Add(roundTrip / 2)
+	offset := local.Sub(time.UnixMilli(serverMs))
+
+	c.timeOffset = offset
+	c.roundTrip = roundTrip
+	c.syncedAt = end
+	c.timeErr = nil
+	return nil
+}
+
+// signed returns the library client for a signed request, which stamps it
+// with local time minus the measured offset. Each request gets its own copy
+// so a concurrent sync never changes a client in use.
+func (c *Client) signed() *binance.Client {
+	c.timeMu.Lock()
+	offset := c.timeOffset
+	c.timeMu.Unlock()
+	api := *c.api
+	api.TimeOffset = offset.Milliseconds()
+	return &api
+}
+
+// SyncTime re-measures the clock offset every interval until ctx is done.
+// Orders are refused until a sync succeeds, so failures are retried sooner.
+func (c *Client) SyncTime(ctx context.Context, interval time.Duration) {
+	c.timeMu.Lock()
+	synced := !c.syncedAt.IsZero()
+	c.timeMu.Unlock()
+	poll(ctx, interval, !synced, func() error {
+		if err := c.syncTime(); err != nil {
+			log.Printf("[TIME] Failed to sync with Binance server time: %v", err)
+			return err
+		}
+		c.timeMu.Lock()
+		offset, rtt := c.timeOffset, c.roundTrip
+		c.timeMu.Unlock()
+		if offset.Abs() > c.MaxClockDrift {
+			msg := fmt.Sprintf("[TIME] Local clock is %s off Binance server time; orders are refused", offset)
+			log.Print(msg)
+			c.notifier.Send(msg)
+		} else if offset.Abs() > c.MaxClockDrift/2 {
+			log.Printf("[TIME] Clock offset %s (round trip %s)", offset, rtt)
+		}
+		return nil
+	})
+}
+
+// checkClock refuses orders while the offset to the server clock is
+// unknown or larger than MaxClockDrift, since a bad timestamp gets them
+// rejected with -1021 or, worse, accepted late.
+func (c *Client) checkClock() error {
+	c.timeMu.Lock()
+	defer c.timeMu.Unlock()
+	return c.checkClockLocked()
+}
+
+func (c *Client) checkClockLocked() error {
+	switch {
+	case c.syncedAt.IsZero() && c.timeErr != nil:
+		return fmt.Errorf("%w: not synced with Binance server time: %v", ErrClockDrift, c.timeErr)
+	case c.syncedAt.IsZero():
+		return fmt.Errorf("%w: not synced with Binance server time", ErrClockDrift)
+	case c.timeOffset.Abs() > c.MaxClockDrift:
+		return fmt.Errorf("%w: local clock is %s off Binance server time (limit %s)", ErrClockDrift, c.timeOffset, c.MaxClockDrift)
+	}
+	return nil
+}
+
+// Health reports the clock sync and request weight usage.
+func (c *Client) Health() exchange.Health {
+	used, limit := c.limiter.usage()
+	c.timeMu.Lock()
+	defer c.timeMu.Unlock()
+	h := exchange.Health{
+		Venue:         "binance",
+		Testnet:       c.testnet,
+		ClockOffsetMs: c.timeOffset.Milliseconds(),
+		RoundTripMs:   c.roundTrip.Milliseconds(),
+		ClockSyncedAt: c.syncedAt,
+		UsedWeight:    used,
+		WeightLimit:   limit,
+	}
+	if err := c.checkClockLocked(); err != nil {
+		h.Problems = append(h.Problems, err.Error())
+	}
+	if c.timeErr != nil {
+		h.Problems = append(h.Problems, "last time sync failed: "+c.timeErr.Error())
+	}
+	return h
+}
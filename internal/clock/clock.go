@@ -0,0 +1,43 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so trading logic can run against replayed data.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real reads the wall clock.
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Sim is a manually advanced clock used by the backtester.
+type Sim struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+func NewSim(start time.Time) *Sim {
+	return &Sim{now: start}
+}
+
+func (c *Sim) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Set moves the clock to t. Time never goes backwards.
+func (c *Sim) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
@@ -1,35 +1,55 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"sort"
 
 	"gopkg.in/yaml.v3"
+
+	"traderider/internal/strategy"
 )
 
 type Config struct {
 	Mode string `yaml:"mode"` // "demo" or "real"
 
+	// Symbols lists the traded pairs. Each entry may override any strategy
+	// parameter; unset ones fall back to the global strategy block. When
+	// empty, the built-in pair list runs with the global settings.
+	Symbols []SymbolConfig `yaml:"symbols"`
+
+	// ReportingCurrency is the asset the portfolio value is reported and
+	// hard-stopped in; defaults to USDC.
+	ReportingCurrency string `yaml:"reporting_currency"`
+
 	Binance struct {
 		APIKey     string `yaml:"api_key"`
 		SecretKey  string `yaml:"secret_key"`
 		UseTestnet bool   `yaml:"use_testnet"`
+		// Testnet keys are issued separately at testnet.binance.vision.
+		TestnetAPIKey    string `yaml:"testnet_api_key"`
+		TestnetSecretKey string `yaml:"testnet_secret_key"`
+		// MaxClockDriftMs is the largest offset from Binance server time
+		// at which orders are placed; defaults to 5000.
+		MaxClockDriftMs int `yaml:"max_clock_drift_ms"`
 	} `yaml:"binance"`
 
-	Strategy struct {
-		ShortEMA            int     `yaml:"short_ema"`
-		LongEMA             int     `yaml:"long_ema"`
-		InvestmentPerTrade  float64 `yaml:"investment_per_trade"`
-		MinHoldingThreshold float64 `yaml:"min_holding_threshold"`
-		MinHoldMinutes      int     `yaml:"min_hold_minutes"`
-		MaxHoldingMinutes   int     `yaml:"max_holding_minutes"`
-		MinProfitMargin     float64 `yaml:"min_profit_margin"`
-		SoftStopLoss        float64 `yaml:"soft_stop_loss"`
-		MinTradeGapPercent  float64 `yaml:"min_trade_gap_percent"`
-		UseBollinger        bool    `yaml:"use_bollinger"`
-		BollingerWindow     int     `yaml:"bollinger_window"`
-		CommissionRate      float64 `yaml:"commission_rate"`
-	} `yaml:"strategy"`
+	Strategy StrategyConfig `yaml:"strategy"`
+
+	// Paper configures the simulated exchange used in demo mode.
+	Paper struct {
+		StartingBalance float64 `yaml:"starting_balance"` // per quote asset traded
+		// StartingBalances sets the virtual balance per asset instead.
+		StartingBalances map[string]float64 `yaml:"starting_balances"`
+		CommissionRate   float64            `yaml:"commission_rate"`
+		Slippage         float64            `yaml:"slippage"`
+	} `yaml:"paper"`
+
+	// History controls how long price ticks and candles are kept in the database.
+	History struct {
+		RetentionDays int `yaml:"retention_days"` // defaults to 7; 0 keeps everything
+	} `yaml:"history"`
 
 	WhatsApp struct {
 		Phone  string `yaml:"phone"`
@@ -37,6 +57,184 @@ type Config struct {
 	} `yaml:"whatsapp"`
 }
 
+// StrategyConfig holds the trading parameters for a symbol.
+type StrategyConfig struct {
+	Name                string  `yaml:"name" json:"name"` // default strategy for symbols that do not set one
+	ShortEMA            int     `yaml:"short_ema" json:"shortEMA"`
+	LongEMA             int     `yaml:"long_ema" json:"longEMA"`
+	InvestmentPerTrade  float64 `yaml:"investment_per_trade" json:"investmentPerTrade"`
+	MinHoldingThreshold float64 `yaml:"min_holding_threshold" json:"minHoldingThreshold"`
+	MinHoldMinutes      int     `yaml:"min_hold_minutes" json:"minHoldMinutes"`
+	MaxHoldingMinutes   int     `yaml:"max_holding_minutes" json:"maxHoldingMinutes"`
+	MinProfitMargin     float64 `yaml:"min_profit_margin" json:"minProfitMargin"`
+	SoftStopLoss        float64 `yaml:"soft_stop_loss" json:"softStopLoss"`
+	MinTradeGapPercent  float64 `yaml:"min_trade_gap_percent" json:"minTradeGapPercent"`
+	UseBollinger        bool    `yaml:"use_bollinger" json:"useBollinger"`
+	BollingerWindow     int     `yaml:"bollinger_window" json:"bollingerWindow"`
+	CommissionRate      float64 `yaml:"commission_rate" json:"commissionRate"`
+	MaxEntries          int     `yaml:"max_entries" json:"maxEntries"`           // buys per position including DCA
+	CooldownSeconds     int     `yaml:"cooldown_seconds" json:"cooldownSeconds"` // pause after a sell
+	Timeframe           string  `yaml:"timeframe" json:"timeframe"`              // "" (1s samples), "1m", "5m", "15m" or "1h"
+
+	MinSellIntervalMinutes int                     `yaml:"min_sell_interval_minutes" json:"minSellIntervalMinutes"` // earliest sell after the first buy
+	ReentryDropPercent     float64                 `yaml:"reentry_drop_percent" json:"reentryDropPercent"`          // drop below the last sell before buying again
+	DCADropPercent         float64                 `yaml:"dca_drop_percent" json:"dcaDropPercent"`                  // drop below the average buy before adding an entry
+	MaxBuyRSI              float64                 `yaml:"max_buy_rsi" json:"maxBuyRSI"`
+	BollingerBuyMargin     float64                 `yaml:"bollinger_buy_margin" json:"bollingerBuyMargin"` // buy up to this fraction above the lower band
+	MaxSpread              float64                 `yaml:"max_spread" json:"maxSpread"`
+	TrailingStops          []strategy.TrailingStop `yaml:"trailing_stops" json:"trailingStops"`
+
+	// EntryMode is "market" (default) or "maker": buys rest as post-only
+	// limits at the best bid, re-priced after MakerTimeoutSeconds up to
+	// MakerMaxReprices times (0 never re-prices).
+	EntryMode           string `yaml:"entry_mode" json:"entryMode"`
+	MakerTimeoutSeconds int    `yaml:"maker_timeout_seconds" json:"makerTimeoutSeconds"`
+	MakerMaxReprices    int    `yaml:"maker_max_reprices" json:"makerMaxReprices"`
+	// MakerFallbackMarket buys at market once the reprices are used up.
+	MakerFallbackMarket bool `yaml:"maker_fallback_market" json:"makerFallbackMarket"`
+
+	// Protection is "none" (default), "stop" or "oco": after each buy the
+	// position rests behind an exchange-side stop-loss limit sell, plus a
+	// take-profit leg with "oco", that follows the trailing high.
+	Protection            string  `yaml:"protection" json:"protection"`
+	ProtectionStopLoss    float64 `yaml:"protection_stop_loss" json:"protectionStopLoss"`       // stop below the average buy price
+	ProtectionTakeProfit  float64 `yaml:"protection_take_profit" json:"protectionTakeProfit"`   // oco take-profit above the average buy price
+	ProtectionLimitOffset float64 `yaml:"protection_limit_offset" json:"protectionLimitOffset"` // stop-limit price below the stop price
+	ProtectionUpdateStep  float64 `yaml:"protection_update_step" json:"protectionUpdateStep"`   // minimum stop rise before orders are replaced
+}
+
+// defaultStrategy returns the tuning parameters the bot has always traded
+// with. Load decodes the config over them, so an explicit zero is kept.
+func defaultStrategy() StrategyConfig {
+	return StrategyConfig{
+		MaxEntries:             3,
+		CooldownSeconds:        90,
+		MinSellIntervalMinutes: 12,
+		ReentryDropPercent:     0.005,
+		DCADropPercent:         0.04,
+		MaxBuyRSI:              40,
+		BollingerBuyMargin:     0.02,
+		MaxSpread:              0.002,
+		TrailingStops:          append([]strategy.TrailingStop{}, strategy.DefaultTrailingStops...),
+		EntryMode:              "market",
+		MakerTimeoutSeconds:    30,
+		MakerMaxReprices:       3,
+		Protection:             "none",
+		ProtectionStopLoss:     0.05,
+		ProtectionTakeProfit:   0.05,
+		ProtectionLimitOffset:  0.002,
+		ProtectionUpdateStep:   0.002,
+	}
+}
+
+// Validate reports the first parameter that is out of range.
+func (s *StrategyConfig) Validate() error {
+	switch {
+	case s.ShortEMA <= 0 || s.LongEMA <= s.ShortEMA:
+		return fmt.Errorf("short_ema must be positive and below long_ema (got %d/%d)", s.ShortEMA, s.LongEMA)
+	case s.InvestmentPerTrade <= 0:
+		return fmt.Errorf("investment_per_trade must be positive")
+	case s.MinHoldMinutes < 0 || s.MaxHoldingMinutes < 0 || s.CooldownSeconds < 0 || s.MinSellIntervalMinutes < 0:
+		return fmt.Errorf("durations must not be negative")
+	case s.MaxEntries < 1:
+		return fmt.Errorf("max_entries must be at least 1")
+	case s.UseBollinger && s.BollingerWindow < 2:
+		return fmt.Errorf("bollinger_window must be at least 2")
+	case s.MaxBuyRSI < 0 || s.MaxBuyRSI > 100:
+		return fmt.Errorf("max_buy_rsi must be between 0 and 100")
+	case s.EntryMode != "market" && s.EntryMode != "maker":
+		return fmt.Errorf("entry_mode must be \"market\" or \"maker\", got %q", s.EntryMode)
+	case s.MakerTimeoutSeconds < 1 || s.MakerMaxReprices < 0:
+		return fmt.Errorf("maker_timeout_seconds must be positive and maker_max_reprices not negative")
+	case s.Protection != "none" && s.Protection != "stop" && s.Protection != "oco":
+		return fmt.Errorf("protection must be \"none\", \"stop\" or \"oco\", got %q", s.Protection)
+	case s.ProtectionStopLoss <= 0 || s.ProtectionTakeProfit <= 0:
+		return fmt.Errorf("protection_stop_loss and protection_take_profit must be positive")
+	}
+	fractions := map[string]float64{
+		"commission_rate":         s.CommissionRate,
+		"min_profit_margin":       s.MinProfitMargin,
+		"soft_stop_loss":          s.SoftStopLoss,
+		"min_trade_gap_percent":   s.MinTradeGapPercent,
+		"reentry_drop_percent":    s.ReentryDropPercent,
+		"dca_drop_percent":        s.DCADropPercent,
+		"bollinger_buy_margin":    s.BollingerBuyMargin,
+		"max_spread":              s.MaxSpread,
+		"protection_stop_loss":    s.ProtectionStopLoss,
+		"protection_limit_offset": s.ProtectionLimitOffset,
+		"protection_update_step":  s.ProtectionUpdateStep,
+	}
+	names := make([]string, 0, len(fractions))
+	for name := range fractions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v := fractions[name]; v < 0 || v >= 1 {
+			return fmt.Errorf("%s must be a fraction in [0, 1), got %v", name, v)
+		}
+	}
+	for _, t := range s.TrailingStops {
+		if t.Stop <= 0 || t.Stop >= 1 {
+			return fmt.Errorf("trailing stop %v at min_profit %v must be a fraction in (0, 1)", t.Stop, t.MinProfit)
+		}
+	}
+	return nil
+}
+
+type SymbolConfig struct {
+	Symbol   string `yaml:"symbol"`
+	Strategy string `yaml:"strategy"` // strategy name; overrides strategy.name
+	// Params is the global strategy block with this symbol's overrides applied.
+	Params StrategyConfig `yaml:"-"`
+	node   yaml.Node
+}
+
+// UnmarshalYAML keeps the raw entry so Load can apply it over the global
+// strategy block once that has been decoded.
+func (s *SymbolConfig) UnmarshalYAML(n *yaml.Node) error {
+	type plain SymbolConfig
+	if err := n.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.node = *n
+	return nil
+}
+
+// DefaultSymbols are traded when the config does not list any.
+var DefaultSymbols = []string{"BTCUSDC", "XRPUSDC", "SOLUSDC", "LINKUSDC", "SUIUSDC"}
+
+// SymbolNames returns the configured pairs, or DefaultSymbols.
+func (c *Config) SymbolNames() []string {
+	if len(c.Symbols) == 0 {
+		return DefaultSymbols
+	}
+	names := make([]string, len(c.Symbols))
+	for i, s := range c.Symbols {
+		names[i] = s.Symbol
+	}
+	return names
+}
+
+// ParamsFor returns the strategy parameters for a symbol.
+func (c *Config) ParamsFor(symbol string) StrategyConfig {
+	for _, s := range c.Symbols {
+		if s.Symbol == symbol {
+			return s.Params
+		}
+	}
+	return c.Strategy
+}
+
+// BinanceCredentials returns the API keys for the configured Binance
+// environment: the testnet keys when use_testnet is set.
+func (c *Config) BinanceCredentials() (apiKey, secretKey string) {
+	if c.Binance.UseTestnet {
+		return c.Binance.TestnetAPIKey, c.Binance.TestnetSecretKey
+	}
+	return c.Binance.APIKey, c.Binance.SecretKey
+}
+
 // Load parses a YAML config file from the given path
 func Load(path string) *Config {
 	f, err := os.Open(path)
@@ -45,11 +243,43 @@ func Load(path string) *Config {
 	}
 	defer f.Close()
 
+	// Defaults are set before decoding so that an explicit zero is kept.
 	var cfg Config
+	cfg.History.RetentionDays = 7
+	cfg.Strategy = defaultStrategy()
 	dec := yaml.NewDecoder(f)
 	if err := dec.Decode(&cfg); err != nil {
 		log.Fatalf("failed to decode config file: %v", err)
 	}
 
+	if cfg.Mode == "real" && cfg.Binance.UseTestnet && (cfg.Binance.TestnetAPIKey == "" || cfg.Binance.TestnetSecretKey == "") {
+		log.Fatalf("invalid binance config: use_testnet needs testnet_api_key and testnet_secret_key")
+	}
+	if cfg.Binance.MaxClockDriftMs == 0 {
+		cfg.Binance.MaxClockDriftMs = 5000
+	}
+	if cfg.ReportingCurrency == "" {
+		cfg.ReportingCurrency = "USDC"
+	}
+	if cfg.History.RetentionDays < 0 {
+		log.Fatalf("invalid history config: retention_days must not be negative")
+	}
+	if err := cfg.Strategy.Validate(); err != nil {
+		log.Fatalf("invalid strategy config: %v", err)
+	}
+	for i := range cfg.Symbols {
+		sc := &cfg.Symbols[i]
+		sc.Params = cfg.Strategy
+		if err := sc.node.Decode(&sc.Params); err != nil {
+			log.Fatalf("failed to decode settings for %s: %v", sc.Symbol, err)
+		}
+		if sc.Strategy != "" {
+			sc.Params.Name = sc.Strategy
+		}
+		if err := sc.Params.Validate(); err != nil {
+			log.Fatalf("invalid strategy config for %s: %v", sc.Symbol, err)
+		}
+	}
+
 	return &cfg
 }
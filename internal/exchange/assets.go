@@ -0,0 +1,46 @@
+package exchange
+
+import "strings"
+
+// QuoteAssets are the quote currencies recognised in symbol names when the
+// exchange does not report a symbol's assets. Longer names come first so
+// that e.g. FDUSD is not read as USD.
+var QuoteAssets = []string{"FDUSD", "USDC", "USDT", "TUSD", "EUR", "TRY", "BTC", "ETH", "BNB"}
+
+// SplitSymbol splits a symbol such as BTCUSDT into its base and quote
+// assets by its quote suffix. Unknown quotes give an empty quote asset.
+func SplitSymbol(symbol string) (base, quote string) {
+	for _, q := range QuoteAssets {
+		if len(symbol) > len(q) && strings.HasSuffix(symbol, q) {
+			return strings.TrimSuffix(symbol, q), q
+		}
+	}
+	return symbol, ""
+}
+
+// Assets returns the base and quote asset of symbol from the exchange's
+// symbol info, falling back to SplitSymbol.
+func Assets(ex interface{ GetSymbolFilter(string) SymbolFilter }, symbol string) (base, quote string) {
+	if f := ex.GetSymbolFilter(symbol); f.BaseAsset != "" && f.QuoteAsset != "" {
+		return f.BaseAsset, f.QuoteAsset
+	}
+	return SplitSymbol(symbol)
+}
+
+// ConversionRate returns the value of one unit of from in to, using the
+// direct or the inverse pair. Only pairs the exchange lists are priced; it
+// returns 0 when there is none or it has no price.
+func ConversionRate(ex Exchange, from, to string) float64 {
+	if from == to {
+		return 1
+	}
+	if f := ex.GetSymbolFilter(from + to); f.QuoteAsset == to {
+		return ex.GetSymbolPrice(from + to)
+	}
+	if f := ex.GetSymbolFilter(to + from); f.QuoteAsset == from {
+		if p := ex.GetSymbolPrice(to + from); p > 0 {
+			return 1 / p
+		}
+	}
+	return 0
+}
@@ -0,0 +1,203 @@
+package exchange
+
+import "time"
+
+// Exchange is the venue abstraction used by traders, the wallet, the market
+// watcher and the API. The Binance client is the production implementation.
+type Exchange interface {
+	// GetSymbolPrice returns the last traded price, or 0 if unavailable.
+	GetSymbolPrice(symbol string) float64
+	// GetSpread returns (ask - bid) / bid from the top of the order book.
+	GetSpread(symbol string) float64
+	// GetAssetBalance returns the free balance of an asset.
+	GetAssetBalance(asset string) (float64, error)
+	// GetSymbolFilter returns the trading rules for a symbol.
+	GetSymbolFilter(symbol string) SymbolFilter
+	// CalculateBuyQty converts a quote amount into an order quantity that
+	// satisfies the symbol filters.
+	CalculateBuyQty(symbol string, available float64) (float64, error)
+	MarketBuy(symbol string, quantity float64) (*Order, error)
+	MarketSell(symbol string, quantity float64) (*Order, error)
+}
+
+const (
+	SideBuy  = "BUY"
+	SideSell = "SELL"
+
+	OrderTypeMarket     = "MARKET"
+	OrderTypeLimit      = "LIMIT"
+	OrderTypeLimitMaker = "LIMIT_MAKER"
+	OrderTypeStopLoss   = "STOP_LOSS_LIMIT"
+
+	StatusNew             = "NEW"
+	StatusPartiallyFilled = "PARTIALLY_FILLED"
+	StatusFilled          = "FILLED"
+	StatusCanceled        = "CANCELED"
+	StatusRejected        = "REJECTED"
+	StatusExpired         = "EXPIRED"
+)
+
+// Order is the exchange's view of a placed order, including its fills.
+type Order struct {
+	Symbol        string
+	OrderID       int64
+	Side          string
+	Type          string
+	Status        string
+	Price         float64 // limit price; 0 for market orders
+	StopPrice     float64 // trigger price of stop orders
+	OrderListID   int64   // OCO list the order belongs to; not positive for standalone orders
+	ClientOrderID string
+	OrigQty       float64
+	ExecutedQty   float64
+	QuoteQty      float64
+	Fills         []Fill
+	Time          time.Time
+}
+
+type Fill struct {
+	TradeID         int64
+	Price           float64
+	Qty             float64
+	Commission      float64
+	CommissionAsset string
+}
+
+// AvgPrice returns the quantity-weighted fill price, or the executed quote
+// amount over the executed quantity when fills are not included.
+func (o *Order) AvgPrice() float64 {
+	totalPrice, totalQty := 0.0, 0.0
+	for _, f := range o.Fills {
+		totalPrice += f.Price * f.Qty
+		totalQty += f.Qty
+	}
+	if totalQty == 0 {
+		if o.ExecutedQty > 0 {
+			return o.QuoteQty / o.ExecutedQty
+		}
+		return 0
+	}
+	return totalPrice / totalQty
+}
+
+// IsOpen reports whether the order can still fill.
+func (o *Order) IsOpen() bool {
+	return o.Status == StatusNew || o.Status == StatusPartiallyFilled
+}
+
+// Commission returns the total commission charged in the given asset.
+func (o *Order) Commission(asset string) float64 {
+	total := 0.0
+	for _, f := range o.Fills {
+		if f.CommissionAsset == asset {
+			total += f.Commission
+		}
+	}
+	return total
+}
+
+// Quote is a real-time market data update. Trade updates carry Price and Qty,
+// book updates carry Bid and Ask.
+type Quote struct {
+	Symbol string
+	Price  float64
+	Qty    float64
+	Bid    float64
+	Ask    float64
+	Time   time.Time
+}
+
+// Streamer is implemented by exchanges that can push market data.
+type Streamer interface {
+	// StreamQuotes subscribes to trade and best bid/ask updates. The returned
+	// done channel is closed when the connection ends; stop closes it early.
+	StreamQuotes(symbols []string, handler func(Quote), errHandler func(error)) (done <-chan struct{}, stop func(), err error)
+}
+
+type Kline struct {
+	OpenTime time.Time
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Volume   float64
+}
+
+// KlineSource is implemented by exchanges that serve historical candles.
+type KlineSource interface {
+	// GetKlines returns the most recent limit candles for an interval such
+	// as "1s", "1m" or "1h", oldest first.
+	GetKlines(symbol, interval string, limit int) ([]Kline, error)
+}
+
+// LimitOrderer is implemented by exchanges that accept resting limit orders.
+type LimitOrderer interface {
+	// LimitOrder places a GTC limit order. With postOnly it is sent as
+	// LIMIT_MAKER and rejected if it would trade immediately.
+	LimitOrder(symbol, side string, quantity, price float64, postOnly bool) (*Order, error)
+	// GetOrder returns the current state of an order, including its fills.
+	GetOrder(symbol string, orderID int64) (*Order, error)
+	// CancelOrder cancels an open order and returns its final state.
+	CancelOrder(symbol string, orderID int64) (*Order, error)
+}
+
+// BookTicker is implemented by exchanges that report the best bid and ask.
+type BookTicker interface {
+	GetBookTicker(symbol string) (bid, ask float64, err error)
+}
+
+// StopOrderer is implemented by exchanges that can hold protective sell
+// orders, so a position stays protected when the bot is not running.
+type StopOrderer interface {
+	LimitOrderer
+	// StopLossLimit places a sell that rests as a limit at limitPrice once
+	// the market trades at or below stopPrice.
+	StopLossLimit(symbol string, quantity, stopPrice, limitPrice float64) (*Order, error)
+	// PlaceOCO places a take-profit limit sell and a stop-loss limit sell as
+	// one list: when either executes the other is cancelled, and cancelling
+	// either leg cancels both.
+	PlaceOCO(symbol string, quantity, takeProfit, stopPrice, stopLimitPrice float64) ([]*Order, error)
+}
+
+// OpenOrderLister is implemented by exchanges that can list the orders
+// resting for a symbol. Fills are not loaded.
+type OpenOrderLister interface {
+	GetOpenOrders(symbol string) ([]*Order, error)
+}
+
+// LockedBalancer is implemented by exchanges that report the part of a
+// balance held by open orders, which GetAssetBalance leaves out.
+type LockedBalancer interface {
+	GetLockedBalance(asset string) (float64, error)
+}
+
+// LockedBalance returns the amount of asset held by open orders, or 0 when
+// the exchange does not report it.
+func LockedBalance(ex Exchange, asset string) float64 {
+	lb, ok := ex.(LockedBalancer)
+	if !ok {
+		return 0
+	}
+	locked, err := lb.GetLockedBalance(asset)
+	if err != nil {
+		return 0
+	}
+	return locked
+}
+
+// Health is a venue's connection status, for monitoring.
+type Health struct {
+	Venue         string    `json:"venue"`
+	Testnet       bool      `json:"testnet"`
+	ClockOffsetMs int64     `json:"clockOffsetMs"` // local clock minus server clock
+	RoundTripMs   int64     `json:"roundTripMs"`
+	ClockSyncedAt time.Time `json:"clockSyncedAt"`
+	UsedWeight    int64     `json:"usedWeight"`
+	WeightLimit   int64     `json:"weightLimit"`
+	Problems      []string  `json:"problems,omitempty"`
+}
+
+// HealthReporter is implemented by exchanges that report their status.
+type HealthReporter interface {
+	Health() Health
+}
@@ -0,0 +1,197 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// SymbolFilter holds a symbol's trading rules. Zero values mean the rule
+// does not apply.
+type SymbolFilter struct {
+	Status string // e.g. TRADING; empty when not reported
+
+	// LOT_SIZE, and MARKET_LOT_SIZE for market orders.
+	MinQty         float64
+	MaxQty         float64
+	StepSize       float64
+	MarketMinQty   float64
+	MarketMaxQty   float64
+	MarketStepSize float64
+
+	// NOTIONAL (or MIN_NOTIONAL). Limits apply to market orders only when
+	// the Apply flags are set, valued at the current price.
+	MinNotional      float64
+	MaxNotional      float64
+	ApplyMinToMarket bool
+	ApplyMaxToMarket bool
+
+	// PRICE_FILTER.
+	TickSize float64
+	MinPrice float64
+	MaxPrice float64
+
+	// PERCENT_PRICE_BY_SIDE (or PERCENT_PRICE): the range a limit price may
+	// be in, as multiples of the current price, for buys (bid) and sells (ask).
+	BidMultiplierUp   float64
+	BidMultiplierDown float64
+	AskMultiplierUp   float64
+	AskMultiplierDown float64
+
+	// MAX_NUM_ORDERS and MAX_NUM_ALGO_ORDERS: open orders per symbol, and
+	// how many of them may be stop orders.
+	MaxNumOrders     int
+	MaxNumAlgoOrders int
+
+	// BaseAsset and QuoteAsset are set for symbols the exchange lists.
+	BaseAsset  string
+	QuoteAsset string
+}
+
+// ErrUnknownSymbol is returned for orders on symbols without trading rules.
+var ErrUnknownSymbol = errors.New("unknown symbol")
+
+// FilterError reports an order that breaks one of a symbol's trading rules.
+type FilterError struct {
+	Symbol string
+	Filter string // the Binance filter type, e.g. LOT_SIZE
+	Reason string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%s order rejected by %s: %s", e.Symbol, e.Filter, e.Reason)
+}
+
+// FloorPrice rounds a price down to the symbol's tick size.
+func (f SymbolFilter) FloorPrice(price float64) float64 {
+	if f.TickSize == 0 {
+		return price
+	}
+	return math.Floor(price/f.TickSize+1e-9) * f.TickSize
+}
+
+// QtyStep returns the quantity step for market or other orders.
+func (f SymbolFilter) QtyStep(market bool) float64 {
+	if market && f.MarketStepSize > 0 {
+		return f.MarketStepSize
+	}
+	return f.StepSize
+}
+
+// FloorQty rounds a quantity down to the step for market or other orders.
+func (f SymbolFilter) FloorQty(quantity float64, market bool) float64 {
+	step := f.QtyStep(market)
+	if step == 0 {
+		return quantity
+	}
+	return math.Floor(quantity/step+1e-9) * step
+}
+
+// OrderCheck is an order to validate against a symbol's filters. Quantity
+// and prices should already be rounded to the step and tick size.
+type OrderCheck struct {
+	Symbol    string
+	Side      string
+	Type      string
+	Quantity  float64
+	Price     float64 // limit price; 0 for market orders
+	StopPrice float64
+	// MarketPrice values market orders and anchors the percent price range.
+	MarketPrice float64
+}
+
+// Check validates an order against the filters and returns a *FilterError
+// for the first rule it breaks. The percent price range is checked against
+// MarketPrice where Binance uses a recent average, so it is approximate.
+func (f SymbolFilter) Check(o OrderCheck) error {
+	reject := func(filter, format string, args ...interface{}) error {
+		return &FilterError{Symbol: o.Symbol, Filter: filter, Reason: fmt.Sprintf(format, args...)}
+	}
+	if f.Status != "" && f.Status != "TRADING" {
+		return reject("STATUS", "symbol is %s", f.Status)
+	}
+
+	market := o.Type == OrderTypeMarket
+	minFilter, minQty := "LOT_SIZE", f.MinQty
+	maxFilter, maxQty := "LOT_SIZE", f.MaxQty
+	if market && f.MarketMinQty > 0 {
+		minFilter, minQty = "MARKET_LOT_SIZE", f.MarketMinQty
+	}
+	if market && f.MarketMaxQty > 0 {
+		maxFilter, maxQty = "MARKET_LOT_SIZE", f.MarketMaxQty
+	}
+	switch {
+	case o.Quantity <= 0:
+		return reject(minFilter, "quantity %.8f is not positive", o.Quantity)
+	case o.Quantity < minQty:
+		return reject(minFilter, "quantity %.8f below minimum %.8f", o.Quantity, minQty)
+	case maxQty > 0 && o.Quantity > maxQty:
+		return reject(maxFilter, "quantity %.8f above maximum %.8f", o.Quantity, maxQty)
+	}
+
+	for _, p := range []float64{o.Price, o.StopPrice} {
+		switch {
+		case p == 0:
+		case p < 0:
+			return reject("PRICE_FILTER", "price %.8f is not positive", p)
+		case f.MinPrice > 0 && p < f.MinPrice:
+			return reject("PRICE_FILTER", "price %.8f below minimum %.8f", p, f.MinPrice)
+		case f.MaxPrice > 0 && p > f.MaxPrice:
+			return reject("PRICE_FILTER", "price %.8f above maximum %.8f", p, f.MaxPrice)
+		}
+	}
+
+	price := o.Price
+	if market {
+		price = o.MarketPrice
+	}
+	if price > 0 {
+		notional := o.Quantity * price
+		if f.MinNotional > 0 && notional < f.MinNotional && (!market || f.ApplyMinToMarket) {
+			return reject("NOTIONAL", "notional %.4f below minimum %.4f", notional, f.MinNotional)
+		}
+		if f.MaxNotional > 0 && notional > f.MaxNotional && (!market || f.ApplyMaxToMarket) {
+			return reject("NOTIONAL", "notional %.4f above maximum %.4f", notional, f.MaxNotional)
+		}
+	}
+
+	if !market && o.Price > 0 && o.MarketPrice > 0 {
+		up, down := f.BidMultiplierUp, f.BidMultiplierDown
+		if o.Side == SideSell {
+			up, down = f.AskMultiplierUp, f.AskMultiplierDown
+		}
+		if up > 0 && o.Price > o.MarketPrice*up {
+			return reject("PERCENT_PRICE_BY_SIDE", "price %.8f above %.8f (%.2fx the current price)", o.Price, o.MarketPrice*up, up)
+		}
+		if down > 0 && o.Price < o.MarketPrice*down {
+			return reject("PERCENT_PRICE_BY_SIDE", "price %.8f below %.8f (%.2fx the current price)", o.Price, o.MarketPrice*down, down)
+		}
+	}
+	return nil
+}
+
+// CheckOrderCount checks that placing more orders on symbol stays within
+// MAX_NUM_ORDERS and MAX_NUM_ALGO_ORDERS. open and openAlgo count the orders
+// already resting and the stop orders among them; orders and algo count the
+// new ones the same way.
+func (f SymbolFilter) CheckOrderCount(symbol string, open, openAlgo, orders, algo int) error {
+	if f.MaxNumOrders > 0 && open+orders > f.MaxNumOrders {
+		return &FilterError{Symbol: symbol, Filter: "MAX_NUM_ORDERS",
+			Reason: fmt.Sprintf("%d open orders, limit %d", open, f.MaxNumOrders)}
+	}
+	if f.MaxNumAlgoOrders > 0 && openAlgo+algo > f.MaxNumAlgoOrders {
+		return &FilterError{Symbol: symbol, Filter: "MAX_NUM_ALGO_ORDERS",
+			Reason: fmt.Sprintf("%d open stop orders, limit %d", openAlgo, f.MaxNumAlgoOrders)}
+	}
+	return nil
+}
+
+// IsAlgoOrder reports whether an order type counts towards
+// MAX_NUM_ALGO_ORDERS.
+func IsAlgoOrder(typ string) bool {
+	switch typ {
+	case "STOP_LOSS", "STOP_LOSS_LIMIT", "TAKE_PROFIT", "TAKE_PROFIT_LIMIT":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package market
+
+import "time"
+
+// Tick is a sampled price with its observation time.
+type Tick struct {
+	Time  time.Time `json:"time"`
+	Price float64   `json:"price"`
+}
+
+type Candle struct {
+	OpenTime time.Time `json:"openTime"`
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Volume   float64   `json:"volume"`
+}
+
+// Intervals are the candle timeframes built for every symbol.
+var Intervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+}
+
+// maxCandles bounds the per-interval history kept in memory.
+const maxCandles = 500
+
+// addTrade folds a trade into the candle series for one interval and returns
+// the updated series. Trades older than the current bar are ignored.
+func addTrade(series []Candle, d time.Duration, ts time.Time, price, qty float64) []Candle {
+	open := ts.Truncate(d)
+	if n := len(series); n > 0 {
+		last := &series[n-1]
+		if open.Equal(last.OpenTime) {
+			last.High = max(last.High, price)
+			last.Low = min(last.Low, price)
+			last.Close = price
+			last.Volume += qty
+			return series
+		}
+		if open.Before(last.OpenTime) {
+			return series
+		}
+	}
+	series = append(series, Candle{OpenTime: open, Open: price, High: price, Low: price, Close: price, Volume: qty})
+	if len(series) > maxCandles {
+		series = series[len(series)-maxCandles:]
+	}
+	return series
+}
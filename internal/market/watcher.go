@@ -1,63 +1,364 @@
 package market
 
 import (
-	"math/rand"
+	"context"
+	"fmt"
+	"log"
 	"sync"
 	"time"
 
-	"traderider/internal/binance"
+	"traderider/internal/exchange"
+	"traderider/internal/store"
 )
 
+const (
+	// staleAfter is how long a streamed price stays valid before the watcher
+	// falls back to REST for that symbol.
+	staleAfter = 10 * time.Second
+	// reconnectAfter forces a resubscribe when no symbol has updated for this long.
+	reconnectAfter = 30 * time.Second
+	maxBackoff     = time.Minute
+	// flushEvery is how often recorded history is written to the store.
+	flushEvery = 10 * time.Second
+)
+
+type book struct {
+	bid, ask float64
+	updated  time.Time
+}
+
 type MarketWatcher struct {
-	mu      sync.RWMutex
-	prices  map[string]float64
-	history map[string][]float64
-	maxLen  int
-	demo    bool
-	binance *binance.Client
+	mu       sync.RWMutex
+	symbols  []string
+	prices   map[string]float64
+	history  map[string][]Tick
+	candles  map[string]map[string][]Candle
+	books    map[string]book
+	updated  map[string]time.Time
+	maxLen   int
+	exchange exchange.Exchange
+	// pending holds ticks not yet written to the store; nil unless Persist runs.
+	pending map[string][]store.PriceTick
 }
 
 // NewWatcher creates a MarketWatcher that tracks multiple symbols.
-func NewWatcher(demo bool, binClient *binance.Client) *MarketWatcher {
+func NewWatcher(ex exchange.Exchange) *MarketWatcher {
 	return &MarketWatcher{
-		prices:  make(map[string]float64),
-		history: make(map[string][]float64),
-		maxLen:  300, // ~5 minutes of data at 1s intervals
-		demo:    demo,
-		binance: binClient,
+		prices:   make(map[string]float64),
+		history:  make(map[string][]Tick),
+		candles:  make(map[string]map[string][]Candle),
+		books:    make(map[string]book),
+		updated:  make(map[string]time.Time),
+		maxLen:   300, // ~5 minutes of data at 1s intervals
+		exchange: ex,
+	}
+}
+
+// Start backfills history for the given symbols, then streams their prices
+// and samples them into history once per second. If the exchange cannot
+// stream, or the stream is down or stale, prices are fetched over REST instead.
+// It blocks until ctx is done and the stream is closed.
+func (m *MarketWatcher) Start(ctx context.Context, symbols []string) {
+	for _, symbol := range symbols {
+		m.addSymbol(symbol)
+	}
+	sampled := make(chan struct{})
+	go func() {
+		m.sample(ctx)
+		close(sampled)
+	}()
+	defer func() { <-sampled }()
+
+	streamer, ok := m.exchange.(exchange.Streamer)
+	if !ok {
+		return
+	}
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		symbols := m.Symbols()
+		done, stop, err := streamer.StreamQuotes(symbols, m.onQuote, func(err error) {
+			log.Printf("[WS] Stream error: %v", err)
+		})
+		if err != nil {
+			log.Printf("[WS] Subscribe failed: %v (retrying in %s, REST fallback active)", err, backoff)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		log.Printf("[WS] Subscribed to %d symbols", len(symbols))
+		backoff = time.Second
+		m.watchStream(ctx, symbols, done, stop)
+		if ctx.Err() == nil {
+			log.Printf("[WS] Stream closed, resubscribing")
+		}
+	}
+}
+
+func (m *MarketWatcher) addSymbol(symbol string) {
+	m.mu.Lock()
+	for _, s := range m.symbols {
+		if s == symbol {
+			m.mu.Unlock()
+			return
+		}
+	}
+	m.symbols = append(m.symbols, symbol)
+	m.mu.Unlock()
+
+	m.backfill(symbol)
+}
+
+// Symbols returns the symbols currently tracked.
+func (m *MarketWatcher) Symbols() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string{}, m.symbols...)
+}
+
+// backfill seeds the one-second history and every candle interval from the
+// exchange's klines so indicators are meaningful right after startup.
+func (m *MarketWatcher) backfill(symbol string) {
+	src, ok := m.exchange.(exchange.KlineSource)
+	if !ok {
+		return
+	}
+
+	seconds, err := src.GetKlines(symbol, "1s", m.maxLen)
+	if err != nil {
+		log.Printf("[BACKFILL] %s: failed to load 1s klines: %v", symbol, err)
+	}
+	candles := make(map[string][]Candle)
+	for name := range Intervals {
+		klines, err := src.GetKlines(symbol, name, maxCandles)
+		if err != nil {
+			log.Printf("[BACKFILL] %s: failed to load %s klines: %v", symbol, name, err)
+			continue
+		}
+		for _, k := range klines {
+			candles[name] = append(candles[name], Candle{OpenTime: k.OpenTime, Open: k.Open, High: k.High, Low: k.Low, Close: k.Close, Volume: k.Volume})
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ticks []Tick
+	for _, k := range seconds {
+		if len(m.history[symbol]) > 0 && !k.OpenTime.Before(m.history[symbol][0].Time) {
+			break
+		}
+		ticks = append(ticks, Tick{Time: k.OpenTime, Price: k.Close})
+	}
+	m.history[symbol] = append(ticks, m.history[symbol]...)
+	if len(m.history[symbol]) > m.maxLen {
+		m.history[symbol] = m.history[symbol][len(m.history[symbol])-m.maxLen:]
+	}
+	if m.prices[symbol] == 0 && len(ticks) > 0 {
+		m.prices[symbol] = ticks[len(ticks)-1].Price
+	}
+
+	if m.candles[symbol] == nil {
+		m.candles[symbol] = make(map[string][]Candle)
+	}
+	for name, series := range candles {
+		live := m.candles[symbol][name]
+		for len(series) > 0 && len(live) > 0 && !series[len(series)-1].OpenTime.Before(live[0].OpenTime) {
+			series = series[:len(series)-1]
+		}
+		m.candles[symbol][name] = append(series, live...)
+	}
+
+	log.Printf("[BACKFILL] %s: %d ticks, %d 1m candles", symbol, len(ticks), len(m.candles[symbol]["1m"]))
+}
+
+// watchStream blocks until the stream ends, stopping it if every symbol goes
+// quiet or ctx is done.
+func (m *MarketWatcher) watchStream(ctx context.Context, symbols []string, done <-chan struct{}, stop func()) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	connected := time.Now()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			stop()
+			<-done
+			return
+		case <-ticker.C:
+			if time.Since(connected) > reconnectAfter && m.allStale(symbols, reconnectAfter) {
+				log.Printf("[WS] No updates for %s, reconnecting", reconnectAfter)
+				stop()
+			}
+		}
+	}
+}
+
+func (m *MarketWatcher) onQuote(q exchange.Quote) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if q.Bid > 0 && q.Ask > 0 {
+		m.books[q.Symbol] = book{bid: q.Bid, ask: q.Ask, updated: now}
+		if m.prices[q.Symbol] == 0 {
+			m.prices[q.Symbol] = (q.Bid + q.Ask) / 2
+		}
+	}
+	if q.Price > 0 {
+		m.prices[q.Symbol] = q.Price
+		m.addToCandles(q.Symbol, q.Time, q.Price, q.Qty)
+	}
+	m.updated[q.Symbol] = now
+}
+
+func (m *MarketWatcher) allStale(symbols []string, age time.Duration) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, symbol := range symbols {
+		if time.Since(m.updated[symbol]) < age {
+			return false
+		}
 	}
+	return true
 }
 
-// Start begins polling prices for the given symbols in a goroutine.
-func (m *MarketWatcher) Start(symbols []string) {
+// sample appends the latest price of each symbol to its history every
+// second until ctx is done.
+func (m *MarketWatcher) sample(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		m.mu.Lock()
-		for _, symbol := range symbols {
-			price := m.fetchPrice(symbol)
-			m.prices[symbol] = price
-			m.history[symbol] = append(m.history[symbol], price)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, symbol := range m.Symbols() {
+			m.mu.RLock()
+			price, fresh := m.prices[symbol], time.Since(m.updated[symbol]) < staleAfter
+			m.mu.RUnlock()
 
-			if len(m.history[symbol]) > m.maxLen {
-				m.history[symbol] = m.history[symbol][1:]
+			if !fresh {
+				price = m.fetchPrice(symbol)
+			}
+			if price > 0 {
+				m.Record(symbol, price, time.Now())
 			}
 		}
-		m.mu.Unlock()
 	}
 }
 
-// fetchPrice retrieves the price for a symbol from Binance or simulates it in demo mode.
-func (m *MarketWatcher) fetchPrice(symbol string) float64 {
-	if m.demo {
-		base := m.prices[symbol]
-		if base == 0 {
-			base = 100.0
+// Record stores a price observation for a symbol. The backtester uses it to
+// feed replayed prices.
+func (m *MarketWatcher) Record(symbol string, price float64, ts time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prices[symbol] = price
+	m.history[symbol] = append(m.history[symbol], Tick{Time: ts, Price: price})
+	m.addToCandles(symbol, ts, price, 0)
+
+	if len(m.history[symbol]) > m.maxLen {
+		m.history[symbol] = m.history[symbol][1:]
+	}
+	if m.pending != nil {
+		m.pending[symbol] = append(m.pending[symbol], store.PriceTick{Time: ts, Price: price})
+	}
+}
+
+// Persist writes sampled ticks and candles to the store every flushEvery and
+// deletes history older than retention once an hour. A zero retention keeps
+// everything. It blocks until ctx is done, then flushes what is pending.
+func (m *MarketWatcher) Persist(ctx context.Context, db *store.Store, retention time.Duration) {
+	m.mu.Lock()
+	m.pending = make(map[string][]store.PriceTick)
+	m.mu.Unlock()
+
+	flush := time.NewTicker(flushEvery)
+	defer flush.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	if retention > 0 {
+		m.prune(db, retention)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.flush(db)
+			return
+		case <-flush.C:
+			m.flush(db)
+		case <-prune.C:
+			if retention > 0 {
+				m.prune(db, retention)
+			}
 		}
-		return base + rand.Float64()*2 - 1
 	}
-	return m.binance.GetSymbolPrice(symbol)
+}
+
+// flush saves pending ticks and the last two candles of every interval: the
+// one that most recently closed and the one still forming.
+func (m *MarketWatcher) flush(db *store.Store) {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[string][]store.PriceTick)
+	candles := make(map[string]map[string][]store.Candle)
+	for symbol, series := range m.candles {
+		candles[symbol] = make(map[string][]store.Candle)
+		for name, cs := range series {
+			for _, c := range cs[max(len(cs)-2, 0):] {
+				candles[symbol][name] = append(candles[symbol][name], store.Candle(c))
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for symbol, ticks := range pending {
+		if err := db.SaveTicks(symbol, ticks); err != nil {
+			log.Printf("[HISTORY] %s: failed to save ticks: %v", symbol, err)
+		}
+	}
+	for symbol, series := range candles {
+		for name, cs := range series {
+			if err := db.SaveCandles(symbol, name, cs); err != nil {
+				log.Printf("[HISTORY] %s: failed to save %s candles: %v", symbol, name, err)
+			}
+		}
+	}
+}
+
+func (m *MarketWatcher) prune(db *store.Store, retention time.Duration) {
+	n, err := db.PruneHistory(time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("[HISTORY] Prune failed: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("[HISTORY] Pruned %d rows older than %s", n, retention)
+	}
+}
+
+// addToCandles updates every interval's candles for a symbol. Callers hold m.mu.
+func (m *MarketWatcher) addToCandles(symbol string, ts time.Time, price, qty float64) {
+	series, ok := m.candles[symbol]
+	if !ok {
+		series = make(map[string][]Candle)
+		m.candles[symbol] = series
+	}
+	for name, d := range Intervals {
+		series[name] = addTrade(series[name], d, ts, price, qty)
+	}
+}
+
+// fetchPrice retrieves the price for a symbol from the exchange.
+func (m *MarketWatcher) fetchPrice(symbol string) float64 {
+	return m.exchange.GetSymbolPrice(symbol)
 }
 
 // GetPrice returns the latest price for a symbol.
@@ -67,17 +368,73 @@ func (m *MarketWatcher) GetPrice(symbol string) float64 {
 	return m.prices[symbol]
 }
 
-// GetHistory returns the price history for a symbol.
+// GetSpread returns the relative bid/ask spread from the streamed book, or
+// from the exchange's order book if no fresh quote is available.
+func (m *MarketWatcher) GetSpread(symbol string) float64 {
+	m.mu.RLock()
+	b, ok := m.books[symbol]
+	m.mu.RUnlock()
+	if ok && b.bid > 0 && time.Since(b.updated) < staleAfter {
+		return (b.ask - b.bid) / b.bid
+	}
+	return m.exchange.GetSpread(symbol)
+}
+
+// GetBidAsk returns the best bid and ask from the streamed book, or from the
+// exchange when no fresh quote is available.
+func (m *MarketWatcher) GetBidAsk(symbol string) (float64, float64, error) {
+	m.mu.RLock()
+	b, ok := m.books[symbol]
+	m.mu.RUnlock()
+	if ok && b.bid > 0 && time.Since(b.updated) < staleAfter {
+		return b.bid, b.ask, nil
+	}
+	if bt, ok := m.exchange.(exchange.BookTicker); ok {
+		return bt.GetBookTicker(symbol)
+	}
+	return 0, 0, fmt.Errorf("no order book for %s", symbol)
+}
+
+// GetHistory returns the sampled price history for a symbol.
 func (m *MarketWatcher) GetHistory(symbol string) []float64 {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return append([]float64{}, m.history[symbol]...)
+	prices := make([]float64, len(m.history[symbol]))
+	for i, t := range m.history[symbol] {
+		prices[i] = t.Price
+	}
+	return prices
+}
+
+// GetTicks returns the sampled price history with timestamps.
+func (m *MarketWatcher) GetTicks(symbol string) []Tick {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Tick{}, m.history[symbol]...)
 }
 
-// GetUSDCBalance returns the current USDC balance from Binance.
-func (m *MarketWatcher) GetUSDCBalance() (float64, error) {
-	if m.binance != nil {
-		return m.binance.GetUSDCBalance()
+// GetCandles returns up to n of the most recent candles for an interval
+// ("1m", "5m", "15m", "1h"). The last candle is still forming.
+func (m *MarketWatcher) GetCandles(symbol, interval string, n int) []Candle {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	series := m.candles[symbol][interval]
+	if n > 0 && len(series) > n {
+		series = series[len(series)-n:]
+	}
+	return append([]Candle{}, series...)
+}
+
+// GetSeries returns closing prices for indicator input: the one-second
+// samples when interval is empty, otherwise candle closes.
+func (m *MarketWatcher) GetSeries(symbol, interval string) []float64 {
+	if interval == "" {
+		return m.GetHistory(symbol)
+	}
+	candles := m.GetCandles(symbol, interval, 0)
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
 	}
-	return 0, nil
+	return closes
 }
@@ -9,6 +9,7 @@ import (
 type WhatsAppNotifier struct {
 	Phone  string
 	APIKey string
+	Prefix string // prepended to every message, e.g. to mark the testnet
 }
 
 func NewWhatsAppNotifier(phone, apiKey string) *WhatsAppNotifier {
@@ -19,11 +20,14 @@ func NewWhatsAppNotifier(phone, apiKey string) *WhatsAppNotifier {
 }
 
 func (n *WhatsAppNotifier) Send(message string) {
+	if n.Phone == "" {
+		return
+	}
 	baseURL := "https://api.callmebot.com/whatsapp.php"
 
 	params := url.Values{}
 	params.Add("phone", n.Phone)
-	params.Add("text", message)
+	params.Add("text", n.Prefix+message)
 	params.Add("apikey", n.APIKey)
 
 	reqURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
@@ -0,0 +1,709 @@
+package paper
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"traderider/internal/clock"
+	"traderider/internal/exchange"
+)
+
+var (
+	_ exchange.Exchange        = (*Exchange)(nil)
+	_ exchange.Streamer        = (*Exchange)(nil)
+	_ exchange.KlineSource     = (*Exchange)(nil)
+	_ exchange.LimitOrderer    = (*Exchange)(nil)
+	_ exchange.BookTicker      = (*Exchange)(nil)
+	_ exchange.StopOrderer     = (*Exchange)(nil)
+	_ exchange.OpenOrderLister = (*Exchange)(nil)
+	_ exchange.HealthReporter  = (*Exchange)(nil)
+	_ exchange.LockedBalancer  = (*Exchange)(nil)
+)
+
+// MarketData is the read-only part of a venue the simulator prices against.
+type MarketData interface {
+	GetSymbolPrice(symbol string) float64
+	GetSpread(symbol string) float64
+	GetSymbolFilter(symbol string) exchange.SymbolFilter
+}
+
+type Config struct {
+	StartingBalance  float64            // virtual USDC, used when StartingBalances is empty
+	StartingBalances map[string]float64 // virtual balance per asset
+	CommissionRate   float64
+	Slippage         float64
+	Clock            clock.Clock // defaults to the wall clock
+}
+
+// Exchange is a paper-trading venue. It reads prices and symbol filters from
+// a real market data source and settles orders against virtual balances.
+type Exchange struct {
+	mu          sync.Mutex
+	feed        MarketData
+	cfg         Config
+	balances    map[string]float64
+	orders      map[int64]*exchange.Order // resting limit orders by ID
+	triggered   map[int64]bool            // stop orders whose stop price has been reached
+	nextOrderID int64
+	nextTradeID int64
+	nextListID  int64
+	path        string // file Load read, rewritten after every change
+}
+
+func NewExchange(feed MarketData, cfg Config) *Exchange {
+	if cfg.Clock == nil {
+		cfg.Clock = clock.Real{}
+	}
+	balances := map[string]float64{"USDC": cfg.StartingBalance}
+	if len(cfg.StartingBalances) > 0 {
+		balances = make(map[string]float64, len(cfg.StartingBalances))
+		for asset, amount := range cfg.StartingBalances {
+			balances[asset] = amount
+		}
+	}
+	return &Exchange{
+		feed:        feed,
+		cfg:         cfg,
+		balances:    balances,
+		orders:      make(map[int64]*exchange.Order),
+		triggered:   make(map[int64]bool),
+		nextOrderID: 1,
+		nextTradeID: 1,
+		nextListID:  1,
+	}
+}
+
+func (e *Exchange) GetSymbolPrice(symbol string) float64 {
+	return e.feed.GetSymbolPrice(symbol)
+}
+
+func (e *Exchange) GetSpread(symbol string) float64 {
+	return e.feed.GetSpread(symbol)
+}
+
+func (e *Exchange) GetSymbolFilter(symbol string) exchange.SymbolFilter {
+	return e.feed.GetSymbolFilter(symbol)
+}
+
+// Health reports the market data source's status when it has one. Its
+// problems are about the clock, which only matters for signed requests,
+// so they are dropped.
+func (e *Exchange) Health() exchange.Health {
+	h := exchange.Health{Venue: "paper"}
+	if r, ok := e.feed.(exchange.HealthReporter); ok {
+		h = r.Health()
+		h.Venue = "paper on " + h.Venue
+		h.Problems = nil
+	}
+	return h
+}
+
+// StreamQuotes forwards to the market data source when it supports streaming.
+func (e *Exchange) StreamQuotes(symbols []string, handler func(exchange.Quote), errHandler func(error)) (<-chan struct{}, func(), error) {
+	if s, ok := e.feed.(exchange.Streamer); ok {
+		return s.StreamQuotes(symbols, handler, errHandler)
+	}
+	return nil, nil, fmt.Errorf("market data source does not support streaming")
+}
+
+// GetKlines forwards to the market data source when it serves candles.
+func (e *Exchange) GetKlines(symbol, interval string, limit int) ([]exchange.Kline, error) {
+	if s, ok := e.feed.(exchange.KlineSource); ok {
+		return s.GetKlines(symbol, interval, limit)
+	}
+	return nil, fmt.Errorf("market data source does not serve klines")
+}
+
+// GetBookTicker forwards to the market data source when it reports the book,
+// otherwise it centres the reported spread on the last price.
+func (e *Exchange) GetBookTicker(symbol string) (float64, float64, error) {
+	if b, ok := e.feed.(exchange.BookTicker); ok {
+		return b.GetBookTicker(symbol)
+	}
+	price := e.GetSymbolPrice(symbol)
+	if price == 0 {
+		return 0, 0, fmt.Errorf("price unavailable for %s", symbol)
+	}
+	half := e.GetSpread(symbol) / 2
+	return price * (1 - half), price * (1 + half), nil
+}
+
+func (e *Exchange) GetAssetBalance(asset string) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.balances[asset], nil
+}
+
+// GetLockedBalance returns the amount of asset held by resting orders. The
+// legs of a list share one lock.
+func (e *Exchange) GetLockedBalance(asset string) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	locked := 0.0
+	seenList := make(map[int64]bool)
+	for _, o := range e.orders {
+		if !o.IsOpen() {
+			continue
+		}
+		if o.OrderListID > 0 {
+			if seenList[o.OrderListID] {
+				continue
+			}
+			seenList[o.OrderListID] = true
+		}
+		base, quote := e.assets(o.Symbol)
+		if o.Side == exchange.SideBuy && quote == asset {
+			locked += o.OrigQty * o.Price
+		} else if o.Side == exchange.SideSell && base == asset {
+			locked += o.OrigQty
+		}
+	}
+	return locked, nil
+}
+
+func (e *Exchange) CalculateBuyQty(symbol string, available float64) (float64, error) {
+	price := e.GetSymbolPrice(symbol)
+	if price == 0 {
+		return 0, fmt.Errorf("price unavailable")
+	}
+	filter := e.GetSymbolFilter(symbol)
+	minQty := filter.FloorQty(filter.MinNotional/price, true)
+	if available < minQty*price {
+		_, quote := e.assets(symbol)
+		return 0, fmt.Errorf("not enough %s", quote)
+	}
+	qty := filter.FloorQty(available/price, true)
+	if filter.MarketMaxQty > 0 && qty > filter.MarketMaxQty {
+		qty = filter.MarketMaxQty
+	}
+	if qty*price < filter.MinNotional {
+		return 0, fmt.Errorf("notional too low")
+	}
+	return qty, nil
+}
+
+func (e *Exchange) MarketBuy(symbol string, quantity float64) (*exchange.Order, error) {
+	return e.fillMarket(symbol, exchange.SideBuy, quantity)
+}
+
+func (e *Exchange) MarketSell(symbol string, quantity float64) (*exchange.Order, error) {
+	return e.fillMarket(symbol, exchange.SideSell, quantity)
+}
+
+// fillMarket executes a market order in full at the current price adjusted
+// for slippage. Commission is charged in the received asset, as on Binance
+// when fees are not paid in BNB.
+func (e *Exchange) fillMarket(symbol, side string, quantity float64) (*exchange.Order, error) {
+	filter := e.GetSymbolFilter(symbol)
+	quantity = filter.FloorQty(quantity, true)
+	price := e.GetSymbolPrice(symbol)
+	if price == 0 {
+		return nil, fmt.Errorf("price unavailable for %s", symbol)
+	}
+	err := filter.Check(exchange.OrderCheck{Symbol: symbol, Side: side, Type: exchange.OrderTypeMarket, Quantity: quantity, MarketPrice: price})
+	if err != nil {
+		return nil, err
+	}
+	if side == exchange.SideBuy {
+		price *= 1 + e.cfg.Slippage
+	} else {
+		price *= 1 - e.cfg.Slippage
+	}
+	notional := quantity * price
+
+	base, quote := e.assets(symbol)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	fill := exchange.Fill{TradeID: e.nextTradeID, Price: price, Qty: quantity}
+	if side == exchange.SideBuy {
+		if e.balances[quote] < notional {
+			return nil, fmt.Errorf("insufficient %s balance: have %.2f, need %.2f", quote, e.balances[quote], notional)
+		}
+		fill.Commission = quantity * e.cfg.CommissionRate
+		fill.CommissionAsset = base
+		e.balances[quote] -= notional
+		e.balances[base] += quantity - fill.Commission
+	} else {
+		if e.balances[base] < quantity {
+			return nil, fmt.Errorf("insufficient %s balance: have %.8f, need %.8f", base, e.balances[base], quantity)
+		}
+		fill.Commission = notional * e.cfg.CommissionRate
+		fill.CommissionAsset = quote
+		e.balances[base] -= quantity
+		e.balances[quote] += notional - fill.Commission
+	}
+
+	order := &exchange.Order{
+		Symbol:        symbol,
+		OrderID:       e.nextOrderID,
+		ClientOrderID: clientOrderID(e.nextOrderID),
+		Side:          side,
+		Type:          exchange.OrderTypeMarket,
+		Status:        exchange.StatusFilled,
+		OrigQty:       quantity,
+		ExecutedQty:   quantity,
+		QuoteQty:      notional,
+		Fills:         []exchange.Fill{fill},
+		Time:          e.cfg.Clock.Now(),
+	}
+	e.nextOrderID++
+	e.nextTradeID++
+	e.persist()
+
+	log.Printf("[PAPER] %s %s %.8f @ %.4f (fee %.8f %s)", side, symbol, quantity, price, fill.Commission, fill.CommissionAsset)
+	return order, nil
+}
+
+// LimitOrder rests a limit order, locking the funds it needs. Resting orders
+// fill at their limit price once the last price reaches it; see Match.
+// A non-post-only order that crosses the book fills immediately as a taker.
+func (e *Exchange) LimitOrder(symbol, side string, quantity, price float64, postOnly bool) (*exchange.Order, error) {
+	filter := e.GetSymbolFilter(symbol)
+	quantity = filter.FloorQty(quantity, false)
+	price = filter.FloorPrice(price)
+	typ := exchange.OrderTypeLimit
+	if postOnly {
+		typ = exchange.OrderTypeLimitMaker
+	}
+	err := filter.Check(exchange.OrderCheck{Symbol: symbol, Side: side, Type: typ, Quantity: quantity, Price: price, MarketPrice: e.GetSymbolPrice(symbol)})
+	if err == nil {
+		err = e.checkOrderCount(symbol, filter, 1, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bid, ask, err := e.GetBookTicker(symbol)
+	if err != nil {
+		return nil, err
+	}
+	crosses := (side == exchange.SideBuy && price >= ask) || (side == exchange.SideSell && price <= bid)
+	if crosses && postOnly {
+		return nil, fmt.Errorf("order would immediately match and take")
+	}
+	if crosses {
+		return e.fillMarket(symbol, side, quantity)
+	}
+
+	base, quote := e.assets(symbol)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	asset, locked := quote, quantity*price
+	if side == exchange.SideSell {
+		asset, locked = base, quantity
+	}
+	if e.balances[asset] < locked {
+		return nil, fmt.Errorf("insufficient %s balance: have %.8f, need %.8f", asset, e.balances[asset], locked)
+	}
+	e.balances[asset] -= locked
+
+	order := &exchange.Order{
+		Symbol:        symbol,
+		OrderID:       e.nextOrderID,
+		ClientOrderID: clientOrderID(e.nextOrderID),
+		Side:          side,
+		Type:          typ,
+		Status:        exchange.StatusNew,
+		Price:         price,
+		OrigQty:       quantity,
+		Time:          e.cfg.Clock.Now(),
+	}
+	e.nextOrderID++
+	e.orders[order.OrderID] = order
+	e.persist()
+
+	log.Printf("[PAPER] %s %s %s %.8f @ %.4f resting", typ, side, symbol, quantity, price)
+	out := *order
+	return &out, nil
+}
+
+func (e *Exchange) GetOrder(symbol string, orderID int64) (*exchange.Order, error) {
+	e.Match(symbol)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	order, ok := e.orders[orderID]
+	if !ok || order.Symbol != symbol {
+		return nil, fmt.Errorf("order %d not found for %s", orderID, symbol)
+	}
+	out := *order
+	return &out, nil
+}
+
+func (e *Exchange) GetOpenOrders(symbol string) ([]*exchange.Order, error) {
+	e.Match(symbol)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var open []*exchange.Order
+	for _, o := range e.orders {
+		if o.Symbol == symbol && o.IsOpen() {
+			out := *o
+			open = append(open, &out)
+		}
+	}
+	return open, nil
+}
+
+// CancelOrder cancels a resting order. Cancelling one leg of an OCO list
+// cancels the whole list, as on Binance.
+func (e *Exchange) CancelOrder(symbol string, orderID int64) (*exchange.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	order, ok := e.orders[orderID]
+	if !ok || order.Symbol != symbol {
+		return nil, fmt.Errorf("order %d not found for %s", orderID, symbol)
+	}
+	if !order.IsOpen() {
+		return nil, fmt.Errorf("order %d is %s", orderID, order.Status)
+	}
+
+	// The legs of a list share one lock on the base asset, refunded once.
+	base, quote := e.assets(symbol)
+	if order.Side == exchange.SideBuy {
+		e.balances[quote] += order.OrigQty * order.Price
+	} else {
+		e.balances[base] += order.OrigQty
+	}
+	for _, o := range e.listOf(order) {
+		o.Status = exchange.StatusCanceled
+		o.Time = e.cfg.Clock.Now()
+		delete(e.triggered, o.OrderID)
+	}
+	e.persist()
+
+	out := *order
+	return &out, nil
+}
+
+// StopLossLimit rests a stop-loss limit sell, locking the base quantity.
+func (e *Exchange) StopLossLimit(symbol string, quantity, stopPrice, limitPrice float64) (*exchange.Order, error) {
+	orders, err := e.placeStop(symbol, quantity, 0, stopPrice, limitPrice)
+	if err != nil {
+		return nil, err
+	}
+	return orders[0], nil
+}
+
+// PlaceOCO rests a take-profit leg and a stop-loss leg sharing one lock on
+// the base quantity. The take-profit leg is returned first.
+func (e *Exchange) PlaceOCO(symbol string, quantity, takeProfit, stopPrice, stopLimitPrice float64) ([]*exchange.Order, error) {
+	return e.placeStop(symbol, quantity, takeProfit, stopPrice, stopLimitPrice)
+}
+
+// placeStop places a stop-loss limit sell, preceded by a take-profit leg in
+// the same list when takeProfit is positive.
+func (e *Exchange) placeStop(symbol string, quantity, takeProfit, stopPrice, limitPrice float64) ([]*exchange.Order, error) {
+	filter := e.GetSymbolFilter(symbol)
+	quantity = filter.FloorQty(quantity, false)
+	stopPrice = filter.FloorPrice(stopPrice)
+	limitPrice = filter.FloorPrice(limitPrice)
+	takeProfit = filter.FloorPrice(takeProfit)
+	price := e.GetSymbolPrice(symbol)
+	err := filter.Check(exchange.OrderCheck{Symbol: symbol, Side: exchange.SideSell, Type: exchange.OrderTypeStopLoss,
+		Quantity: quantity, Price: limitPrice, StopPrice: stopPrice, MarketPrice: price})
+	if err == nil && takeProfit > 0 {
+		err = filter.Check(exchange.OrderCheck{Symbol: symbol, Side: exchange.SideSell, Type: exchange.OrderTypeLimitMaker,
+			Quantity: quantity, Price: takeProfit, MarketPrice: price})
+	}
+	if err == nil {
+		orders := 1
+		if takeProfit > 0 {
+			orders = 2
+		}
+		err = e.checkOrderCount(symbol, filter, orders, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if price <= stopPrice {
+		return nil, fmt.Errorf("stop price %.4f would trigger immediately at %.4f", stopPrice, price)
+	}
+	if takeProfit > 0 && takeProfit <= price {
+		return nil, fmt.Errorf("take-profit %.4f would immediately match at %.4f", takeProfit, price)
+	}
+
+	base, _ := e.assets(symbol)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.balances[base] < quantity {
+		return nil, fmt.Errorf("insufficient %s balance: have %.8f, need %.8f", base, e.balances[base], quantity)
+	}
+	e.balances[base] -= quantity
+
+	listID := int64(-1)
+	var legs []*exchange.Order
+	if takeProfit > 0 {
+		listID = e.nextListID
+		e.nextListID++
+		legs = append(legs, &exchange.Order{
+			Symbol:        symbol,
+			OrderID:       e.nextOrderID,
+			ClientOrderID: clientOrderID(e.nextOrderID),
+			Side:          exchange.SideSell,
+			Type:          exchange.OrderTypeLimitMaker,
+			Status:        exchange.StatusNew,
+			Price:         takeProfit,
+			OrderListID:   listID,
+			OrigQty:       quantity,
+			Time:          e.cfg.Clock.Now(),
+		})
+		e.nextOrderID++
+	}
+	legs = append(legs, &exchange.Order{
+		Symbol:        symbol,
+		OrderID:       e.nextOrderID,
+		ClientOrderID: clientOrderID(e.nextOrderID),
+		Side:          exchange.SideSell,
+		Type:          exchange.OrderTypeStopLoss,
+		Status:        exchange.StatusNew,
+		Price:         limitPrice,
+		StopPrice:     stopPrice,
+		OrderListID:   listID,
+		OrigQty:       quantity,
+		Time:          e.cfg.Clock.Now(),
+	})
+	e.nextOrderID++
+
+	out := make([]*exchange.Order, len(legs))
+	for i, o := range legs {
+		e.orders[o.OrderID] = o
+		cp := *o
+		out[i] = &cp
+	}
+	e.persist()
+	log.Printf("[PAPER] stop-loss SELL %s %.8f stop %.4f limit %.4f take-profit %.4f resting", symbol, quantity, stopPrice, limitPrice, takeProfit)
+	return out, nil
+}
+
+// listOf returns every order in the same OCO list as order, itself included.
+func (e *Exchange) listOf(order *exchange.Order) []*exchange.Order {
+	if order.OrderListID <= 0 {
+		return []*exchange.Order{order}
+	}
+	var list []*exchange.Order
+	for _, o := range e.orders {
+		if o.OrderListID == order.OrderListID {
+			list = append(list, o)
+		}
+	}
+	return list
+}
+
+// Match fills resting orders for a symbol whose limit the last price has
+// reached. Stop orders first wait for the price to fall to their stop, then
+// fill at the market price while it is still at or above their limit.
+// GetOrder calls it; the backtester calls it on every tick.
+func (e *Exchange) Match(symbol string) {
+	price := e.GetSymbolPrice(symbol)
+	if price == 0 {
+		return
+	}
+	base, quote := e.assets(symbol)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	filled := false
+	for _, order := range e.orders {
+		if order.Symbol != symbol || !order.IsOpen() {
+			continue
+		}
+		fillPrice := order.Price
+		if order.Type == exchange.OrderTypeStopLoss {
+			if price <= order.StopPrice {
+				e.triggered[order.OrderID] = true
+			}
+			if !e.triggered[order.OrderID] || price < order.Price {
+				continue
+			}
+			fillPrice = price
+		} else if (order.Side == exchange.SideBuy && price > order.Price) || (order.Side == exchange.SideSell && price < order.Price) {
+			continue
+		}
+
+		notional := order.OrigQty * fillPrice
+		fill := exchange.Fill{TradeID: e.nextTradeID, Price: fillPrice, Qty: order.OrigQty}
+		if order.Side == exchange.SideBuy {
+			fill.Commission = order.OrigQty * e.cfg.CommissionRate
+			fill.CommissionAsset = base
+			e.balances[base] += order.OrigQty - fill.Commission
+		} else {
+			fill.Commission = notional * e.cfg.CommissionRate
+			fill.CommissionAsset = quote
+			e.balances[quote] += notional - fill.Commission
+		}
+		e.nextTradeID++
+
+		// The other legs of a filled list expire; their lock was this order's.
+		for _, o := range e.listOf(order) {
+			if o != order && o.IsOpen() {
+				o.Status = exchange.StatusExpired
+				o.Time = e.cfg.Clock.Now()
+			}
+			delete(e.triggered, o.OrderID)
+		}
+		order.Status = exchange.StatusFilled
+		order.ExecutedQty = order.OrigQty
+		order.QuoteQty = notional
+		order.Fills = []exchange.Fill{fill}
+		order.Time = e.cfg.Clock.Now()
+		filled = true
+		log.Printf("[PAPER] %s %s %s %.8f @ %.4f filled (fee %.8f %s)", order.Type, order.Side, symbol, order.OrigQty, fillPrice, fill.Commission, fill.CommissionAsset)
+	}
+	if filled {
+		e.persist()
+	}
+}
+
+// Balances returns a copy of all virtual balances.
+func (e *Exchange) Balances() map[string]float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make(map[string]float64, len(e.balances))
+	for asset, amount := range e.balances {
+		out[asset] = amount
+	}
+	return out
+}
+
+type savedState struct {
+	Balances    map[string]float64
+	OpenOrders  []*exchange.Order
+	NextOrderID int64
+	NextTradeID int64
+	NextListID  int64
+}
+
+// Load restores balances saved by Save. A missing file keeps the seeded
+// balance. From then on every fill and order change is saved to path, so the
+// file stays in step with the trades recorded in the store.
+func (e *Exchange) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		e.mu.Lock()
+		e.path = path
+		e.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var s savedState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.balances = s.Balances
+	if e.balances == nil {
+		e.balances = make(map[string]float64)
+	}
+	e.orders = make(map[int64]*exchange.Order)
+	e.triggered = make(map[int64]bool)
+	for _, o := range s.OpenOrders {
+		e.orders[o.OrderID] = o
+	}
+	e.nextOrderID = max(s.NextOrderID, 1)
+	e.nextTradeID = max(s.NextTradeID, 1)
+	e.nextListID = max(s.NextListID, 1)
+	e.path = path
+	return nil
+}
+
+// Save writes balances and resting orders, whose funds are locked out of the
+// balances, so a restart does not lose them.
+func (e *Exchange) Save(path string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.save(path)
+}
+
+// persist saves to the file Load read, if any. The caller holds e.mu.
+func (e *Exchange) persist() {
+	if e.path == "" {
+		return
+	}
+	if err := e.save(e.path); err != nil {
+		log.Printf("[ERROR] Failed to save paper balances: %v", err)
+	}
+}
+
+// save writes the state to path. The caller holds e.mu, so saves are written
+// in the order the changes were made.
+func (e *Exchange) save(path string) error {
+	var open []*exchange.Order
+	for _, o := range e.orders {
+		if o.IsOpen() {
+			open = append(open, o)
+		}
+	}
+	data, err := json.MarshalIndent(savedState{
+		Balances:    e.balances,
+		OpenOrders:  open,
+		NextOrderID: e.nextOrderID,
+		NextTradeID: e.nextTradeID,
+		NextListID:  e.nextListID,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces path with data through a temporary file and a
+// rename, so a crash leaves either the old or the new file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func clientOrderID(orderID int64) string {
+	return fmt.Sprintf("paper-%d", orderID)
+}
+
+// checkOrderCount applies MAX_NUM_ORDERS and MAX_NUM_ALGO_ORDERS to the
+// orders resting for symbol.
+func (e *Exchange) checkOrderCount(symbol string, filter exchange.SymbolFilter, orders, algo int) error {
+	e.mu.Lock()
+	open, openAlgo := 0, 0
+	for _, o := range e.orders {
+		if o.Symbol == symbol && o.IsOpen() {
+			open++
+			if exchange.IsAlgoOrder(o.Type) {
+				openAlgo++
+			}
+		}
+	}
+	e.mu.Unlock()
+	return filter.CheckOrderCount(symbol, open, openAlgo, orders, algo)
+}
+
+func (e *Exchange) assets(symbol string) (string, string) {
+	return exchange.Assets(e, symbol)
+}
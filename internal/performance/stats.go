@@ -0,0 +1,104 @@
+package performance
+
+import (
+	"math"
+
+	"traderider/internal/store"
+)
+
+type Stats struct {
+	TotalProfit float64 `json:"totalProfit"`
+	TotalTrades int     `json:"totalTrades"`
+	Wins        int     `json:"wins"`
+	Losses      int     `json:"losses"`
+	WinRate     float64 `json:"winRate"`
+	AvgProfit   float64 `json:"avgProfit"`
+	AvgLoss     float64 `json:"avgLoss"`
+	Score       float64 `json:"score"`
+	AvgHoldMin  float64 `json:"-"`
+}
+
+// Compute matches sells against earlier buys (FIFO) and aggregates the
+// resulting round trips, net of the fees recorded with each trade. Trades
+// recorded without a fee are assumed to have paid commission.
+// txs must be in chronological order.
+func Compute(txs []store.Transaction, commission float64) Stats {
+	var stats Stats
+	type lot struct {
+		amount float64
+		price  float64 // per unit, including the buy fee
+		tx     store.Transaction
+	}
+	var buyStack []lot
+	var holdingDurations []float64
+
+	for _, tx := range txs {
+		if tx.Side == "BUY" {
+			buyStack = append(buyStack, lot{tx.Amount, unitPrice(tx, 1, commission), tx})
+		} else if tx.Side == "SELL" && len(buyStack) > 0 {
+			sellPrice := unitPrice(tx, -1, commission)
+			amtLeft := tx.Amount
+			for len(buyStack) > 0 && amtLeft > 0 {
+				buy := buyStack[0]
+				qty := math.Min(amtLeft, buy.amount)
+
+				profit := (sellPrice - buy.price) * qty
+
+				stats.TotalProfit += profit
+				stats.TotalTrades++
+				if profit > 0 {
+					stats.Wins++
+					stats.AvgProfit += profit
+				} else {
+					stats.Losses++
+					stats.AvgLoss += profit
+				}
+
+				holdingTime := tx.Time.Sub(buy.tx.Time).Minutes()
+				holdingDurations = append(holdingDurations, holdingTime)
+
+				amtLeft -= qty
+				if qty < buy.amount {
+					buyStack[0].amount -= qty
+					break
+				} else {
+					buyStack = buyStack[1:]
+				}
+			}
+		}
+	}
+
+	if stats.Wins > 0 {
+		stats.AvgProfit /= float64(stats.Wins)
+	}
+	if stats.Losses > 0 {
+		stats.AvgLoss /= float64(stats.Losses)
+	}
+	if stats.TotalTrades > 0 {
+		stats.WinRate = float64(stats.Wins) / float64(stats.TotalTrades)
+	}
+
+	for _, h := range holdingDurations {
+		stats.AvgHoldMin += h
+	}
+	if len(holdingDurations) > 0 {
+		stats.AvgHoldMin /= float64(len(holdingDurations))
+	}
+	return stats
+}
+
+// unitPrice spreads a trade's fee over its amount: added to the price for
+// buys (sign 1) and taken off for sells (sign -1).
+func unitPrice(tx store.Transaction, sign, commission float64) float64 {
+	if !tx.FeeRecorded || tx.Amount == 0 {
+		return tx.Price * (1 + sign*commission)
+	}
+	return tx.Price + sign*tx.Fee/tx.Amount
+}
+
+// RawScore = profit/|loss| * winrate * log(trade_count) / avgHold
+func (s Stats) RawScore() float64 {
+	lossAbs := math.Abs(s.AvgLoss) + 0.01
+	confidence := math.Log(float64(s.TotalTrades) + 1)
+	return (s.TotalProfit / lossAbs) * s.WinRate * confidence / (s.AvgHoldMin + 1)
+}
@@ -0,0 +1,155 @@
+package store
+
+import "time"
+
+// Price history is stored with unix-millisecond timestamps so range queries
+// compare numbers rather than driver-formatted time strings.
+const historySchema = `
+    CREATE TABLE IF NOT EXISTS price_ticks (
+        symbol TEXT,
+        time_ms INTEGER,
+        price REAL,
+        PRIMARY KEY (symbol, time_ms)
+    );
+    CREATE TABLE IF NOT EXISTS candles (
+        symbol TEXT,
+        interval TEXT,
+        open_time_ms INTEGER,
+        open REAL,
+        high REAL,
+        low REAL,
+        close REAL,
+        volume REAL,
+        PRIMARY KEY (symbol, interval, open_time_ms)
+    );`
+
+type PriceTick struct {
+	Time  time.Time
+	Price float64
+}
+
+type Candle struct {
+	OpenTime time.Time
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Volume   float64
+}
+
+// SaveTicks records sampled prices. Duplicate timestamps are ignored.
+func (s *Store) SaveTicks(symbol string, ticks []PriceTick) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO price_ticks (symbol, time_ms, price) VALUES (?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, t := range ticks {
+		if _, err := stmt.Exec(symbol, t.Time.UnixMilli(), t.Price); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SaveCandles upserts candles, so a still-forming candle can be saved
+// repeatedly as it updates.
+func (s *Store) SaveCandles(symbol, interval string, candles []Candle) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+        INSERT OR REPLACE INTO candles (symbol, interval, open_time_ms, open, high, low, close, volume)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range candles {
+		if _, err := stmt.Exec(symbol, interval, c.OpenTime.UnixMilli(), c.Open, c.High, c.Low, c.Close, c.Volume); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTicks returns the recorded prices for a symbol in [from, to], oldest first.
+func (s *Store) GetTicks(symbol string, from, to time.Time) ([]PriceTick, error) {
+	rows, err := s.DB.Query(`
+        SELECT time_ms, price
+        FROM price_ticks
+        WHERE symbol = ? AND time_ms BETWEEN ? AND ?
+        ORDER BY time_ms ASC
+    `, symbol, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []PriceTick
+	for rows.Next() {
+		var ms int64
+		var t PriceTick
+		if err := rows.Scan(&ms, &t.Price); err != nil {
+			return nil, err
+		}
+		t.Time = time.UnixMilli(ms)
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// GetCandles returns the recorded candles for a symbol and interval whose
+// open time falls in [from, to], oldest first.
+func (s *Store) GetCandles(symbol, interval string, from, to time.Time) ([]Candle, error) {
+	rows, err := s.DB.Query(`
+        SELECT open_time_ms, open, high, low, close, volume
+        FROM candles
+        WHERE symbol = ? AND interval = ? AND open_time_ms BETWEEN ? AND ?
+        ORDER BY open_time_ms ASC
+    `, symbol, interval, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Candle
+	for rows.Next() {
+		var ms int64
+		var c Candle
+		if err := rows.Scan(&ms, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume); err != nil {
+			return nil, err
+		}
+		c.OpenTime = time.UnixMilli(ms)
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+// PruneHistory deletes ticks and candles older than before and returns the
+// number of rows removed.
+func (s *Store) PruneHistory(before time.Time) (int64, error) {
+	var total int64
+	for _, q := range []string{
+		`DELETE FROM price_ticks WHERE time_ms < ?`,
+		`DELETE FROM candles WHERE open_time_ms < ?`,
+	} {
+		res, err := s.DB.Exec(q, before.UnixMilli())
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
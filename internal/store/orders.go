@@ -0,0 +1,375 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Orders are recorded from the moment they are decided on: a row is created
+// with status PENDING before the order is sent, then updated with the
+// exchange's answer. Every status change is kept in order_events and every
+// fill in order_fills. Positions group the orders of one round trip.
+const ordersSchema = `
+    CREATE TABLE IF NOT EXISTS positions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        symbol TEXT,
+        opened_ms INTEGER,
+        closed_ms INTEGER,
+        pnl REAL
+    );
+    CREATE TABLE IF NOT EXISTS orders (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        position_id INTEGER,
+        symbol TEXT,
+        side TEXT,
+        type TEXT,
+        reason TEXT,
+        client_order_id TEXT,
+        exchange_order_id INTEGER,
+        order_list_id INTEGER,
+        status TEXT,
+        price REAL,
+        stop_price REAL,
+        orig_qty REAL,
+        executed_qty REAL,
+        quote_qty REAL,
+        error TEXT,
+        created_ms INTEGER,
+        updated_ms INTEGER
+    );
+    CREATE INDEX IF NOT EXISTS orders_exchange_id ON orders (symbol, exchange_order_id);
+    CREATE TABLE IF NOT EXISTS order_events (
+        order_id INTEGER,
+        status TEXT,
+        time_ms INTEGER
+    );
+    CREATE TABLE IF NOT EXISTS order_fills (
+        order_id INTEGER,
+        trade_id INTEGER,
+        price REAL,
+        qty REAL,
+        commission REAL,
+        commission_asset TEXT,
+        commission_quote REAL,
+        time_ms INTEGER,
+        PRIMARY KEY (order_id, trade_id)
+    );`
+
+const (
+	// OrderPending is the status of an order that has been recorded but not
+	// yet acknowledged by the exchange.
+	OrderPending = "PENDING"
+	// OrderUnknown marks a pending order whose outcome was never learned and
+	// has been written off.
+	OrderUnknown = "UNKNOWN"
+)
+
+type OrderRecord struct {
+	ID              int64        `json:"id"`
+	PositionID      int64        `json:"positionId"`
+	Symbol          string       `json:"symbol"`
+	Side            string       `json:"side"`
+	Type            string       `json:"type"`
+	Reason          string       `json:"reason"` // why the trader placed it, e.g. "entry" or "protection"
+	ClientOrderID   string       `json:"clientOrderId"`
+	ExchangeOrderID int64        `json:"exchangeOrderId"`
+	OrderListID     int64        `json:"orderListId"`
+	Status          string       `json:"status"`
+	Price           float64      `json:"price"`
+	StopPrice       float64      `json:"stopPrice"`
+	OrigQty         float64      `json:"origQty"`
+	ExecutedQty     float64      `json:"executedQty"`
+	QuoteQty        float64      `json:"quoteQty"`
+	Error           string       `json:"error,omitempty"`
+	CreatedAt       time.Time    `json:"createdAt"`
+	UpdatedAt       time.Time    `json:"updatedAt"`
+	Events          []OrderEvent `json:"events,omitempty"`
+	Fills           []OrderFill  `json:"fills,omitempty"`
+}
+
+type OrderEvent struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+type OrderFill struct {
+	TradeID         int64     `json:"tradeId"`
+	Price           float64   `json:"price"`
+	Qty             float64   `json:"qty"`
+	Commission      float64   `json:"commission"`
+	CommissionAsset string    `json:"commissionAsset"`
+	CommissionQuote float64   `json:"commissionQuote"` // commission valued in the quote asset
+	Time            time.Time `json:"time"`
+}
+
+type Position struct {
+	ID       int64     `json:"id"`
+	Symbol   string    `json:"symbol"`
+	OpenedAt time.Time `json:"openedAt"`
+	ClosedAt time.Time `json:"closedAt"` // zero while open
+	PnL      float64   `json:"pnl"`
+}
+
+// OrderFilter narrows GetOrders. Zero fields match everything.
+type OrderFilter struct {
+	Symbol     string
+	Status     string
+	PositionID int64
+	Limit      int // defaults to 100
+}
+
+// OpenPosition starts a position for symbol and returns its ID.
+func (s *Store) OpenPosition(symbol string, at time.Time) (int64, error) {
+	res, err := s.DB.Exec(`INSERT INTO positions (symbol, opened_ms, closed_ms, pnl) VALUES (?, ?, 0, 0)`, symbol, at.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ClosePosition marks a position closed with its realized profit.
+func (s *Store) ClosePosition(id int64, at time.Time, pnl float64) error {
+	_, err := s.DB.Exec(`UPDATE positions SET closed_ms = ?, pnl = ? WHERE id = ?`, at.UnixMilli(), pnl, id)
+	return err
+}
+
+// GetPositions returns the most recent positions for a symbol, or for all
+// symbols when symbol is empty, newest first.
+func (s *Store) GetPositions(symbol string, limit int) ([]Position, error) {
+	rows, err := s.DB.Query(`
+        SELECT id, symbol, opened_ms, closed_ms, pnl
+        FROM positions
+        WHERE ? = '' OR symbol = ?
+        ORDER BY id DESC
+        LIMIT ?
+    `, symbol, symbol, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Position
+	for rows.Next() {
+		var p Position
+		var opened, closed int64
+		if err := rows.Scan(&p.ID, &p.Symbol, &opened, &closed, &p.PnL); err != nil {
+			return nil, err
+		}
+		p.OpenedAt = time.UnixMilli(opened)
+		if closed > 0 {
+			p.ClosedAt = time.UnixMilli(closed)
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// CreateOrder records an order intent with status PENDING and sets r.ID.
+func (s *Store) CreateOrder(r *OrderRecord) error {
+	if r.Status == "" {
+		r.Status = OrderPending
+	}
+	r.UpdatedAt = r.CreatedAt
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`
+        INSERT INTO orders (position_id, symbol, side, type, reason, client_order_id, exchange_order_id, order_list_id,
+            status, price, stop_price, orig_qty, executed_qty, quote_qty, error, created_ms, updated_ms)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, r.PositionID, r.Symbol, r.Side, r.Type, r.Reason, r.ClientOrderID, r.ExchangeOrderID, r.OrderListID,
+		r.Status, r.Price, r.StopPrice, r.OrigQty, r.ExecutedQty, r.QuoteQty, r.Error, r.CreatedAt.UnixMilli(), r.UpdatedAt.UnixMilli())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if r.ID, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO order_events (order_id, status, time_ms) VALUES (?, ?, ?)`, r.ID, r.Status, r.CreatedAt.UnixMilli()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateOrder saves the exchange's view of a recorded order, logging a status
+// event when the status changed and adding fills not seen before.
+func (s *Store) UpdateOrder(r *OrderRecord) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	var previous string
+	if err := tx.QueryRow(`SELECT status FROM orders WHERE id = ?`, r.ID).Scan(&previous); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("order %d: %w", r.ID, err)
+	}
+	_, err = tx.Exec(`
+        UPDATE orders SET client_order_id = ?, exchange_order_id = ?, order_list_id = ?, status = ?, price = ?,
+            stop_price = ?, orig_qty = ?, executed_qty = ?, quote_qty = ?, error = ?, updated_ms = ?
+        WHERE id = ?
+    `, r.ClientOrderID, r.ExchangeOrderID, r.OrderListID, r.Status, r.Price,
+		r.StopPrice, r.OrigQty, r.ExecutedQty, r.QuoteQty, r.Error, r.UpdatedAt.UnixMilli(), r.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if r.Status != previous {
+		if _, err := tx.Exec(`INSERT INTO order_events (order_id, status, time_ms) VALUES (?, ?, ?)`, r.ID, r.Status, r.UpdatedAt.UnixMilli()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, f := range r.Fills {
+		_, err := tx.Exec(`
+            INSERT OR IGNORE INTO order_fills (order_id, trade_id, price, qty, commission, commission_asset, commission_quote, time_ms)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+        `, r.ID, f.TradeID, f.Price, f.Qty, f.Commission, f.CommissionAsset, f.CommissionQuote, f.Time.UnixMilli())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FindOrder returns the recorded order with the given exchange order ID.
+func (s *Store) FindOrder(symbol string, exchangeOrderID int64) (*OrderRecord, error) {
+	orders, err := s.queryOrders(`WHERE symbol = ? AND exchange_order_id = ? ORDER BY id DESC LIMIT 1`, symbol, exchangeOrderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &orders[0], nil
+}
+
+// GetUnsettledOrders returns the recorded orders for a symbol that were
+// still pending or open when last seen, oldest first.
+func (s *Store) GetUnsettledOrders(symbol string) ([]OrderRecord, error) {
+	return s.queryOrders(`WHERE symbol = ? AND status IN (?, 'NEW', 'PARTIALLY_FILLED') ORDER BY id ASC`, symbol, OrderPending)
+}
+
+// GetOrder returns a recorded order with its status events and fills.
+func (s *Store) GetOrder(id int64) (*OrderRecord, error) {
+	orders, err := s.queryOrders(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	r := &orders[0]
+
+	rows, err := s.DB.Query(`SELECT status, time_ms FROM order_events WHERE order_id = ? ORDER BY rowid ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e OrderEvent
+		var ms int64
+		if err := rows.Scan(&e.Status, &ms); err != nil {
+			return nil, err
+		}
+		e.Time = time.UnixMilli(ms)
+		r.Events = append(r.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	r.Fills, err = s.getFills(id)
+	return r, err
+}
+
+// GetOrders returns recorded orders matching f, newest first, with their fills.
+func (s *Store) GetOrders(f OrderFilter) ([]OrderRecord, error) {
+	var where []string
+	var args []interface{}
+	if f.Symbol != "" {
+		where = append(where, "symbol = ?")
+		args = append(args, f.Symbol)
+	}
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.PositionID != 0 {
+		where = append(where, "position_id = ?")
+		args = append(args, f.PositionID)
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = "WHERE " + strings.Join(where, " AND ")
+	}
+	orders, err := s.queryOrders(clause+" ORDER BY id DESC LIMIT ?", append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		if orders[i].Fills, err = s.getFills(orders[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+func (s *Store) queryOrders(clause string, args ...interface{}) ([]OrderRecord, error) {
+	rows, err := s.DB.Query(`
+        SELECT id, position_id, symbol, side, type, reason, client_order_id, exchange_order_id, order_list_id,
+            status, price, stop_price, orig_qty, executed_qty, quote_qty, error, created_ms, updated_ms
+        FROM orders `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []OrderRecord
+	for rows.Next() {
+		var r OrderRecord
+		var created, updated int64
+		if err := rows.Scan(&r.ID, &r.PositionID, &r.Symbol, &r.Side, &r.Type, &r.Reason, &r.ClientOrderID, &r.ExchangeOrderID, &r.OrderListID,
+			&r.Status, &r.Price, &r.StopPrice, &r.OrigQty, &r.ExecutedQty, &r.QuoteQty, &r.Error, &created, &updated); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.UnixMilli(created)
+		r.UpdatedAt = time.UnixMilli(updated)
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) getFills(orderID int64) ([]OrderFill, error) {
+	rows, err := s.DB.Query(`
+        SELECT trade_id, price, qty, commission, commission_asset, COALESCE(commission_quote, 0), time_ms
+        FROM order_fills
+        WHERE order_id = ?
+        ORDER BY trade_id ASC
+    `, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []OrderFill
+	for rows.Next() {
+		var f OrderFill
+		var ms int64
+		if err := rows.Scan(&f.TradeID, &f.Price, &f.Qty, &f.Commission, &f.CommissionAsset, &f.CommissionQuote, &ms); err != nil {
+			return nil, err
+		}
+		f.Time = time.UnixMilli(ms)
+		result = append(result, f)
+	}
+	return result, rows.Err()
+}
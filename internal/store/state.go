@@ -0,0 +1,85 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Trader state is kept as JSON encoded by the trader package, tagged with
+// the version of its layout so older or newer data is recognised.
+const stateSchema = `
+    CREATE TABLE IF NOT EXISTS trader_state (
+        symbol TEXT PRIMARY KEY,
+        version INTEGER,
+        data TEXT,
+        updated_ms INTEGER
+    );`
+
+// TraderState is the saved state of one symbol's trader.
+type TraderState struct {
+	Symbol    string
+	Version   int
+	Data      []byte
+	UpdatedAt time.Time
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func saveState(db execer, st TraderState) error {
+	_, err := db.Exec(`
+        INSERT INTO trader_state (symbol, version, data, updated_ms) VALUES (?, ?, ?, ?)
+        ON CONFLICT(symbol) DO UPDATE SET version = excluded.version, data = excluded.data, updated_ms = excluded.updated_ms
+    `, st.Symbol, st.Version, string(st.Data), st.UpdatedAt.UnixMilli())
+	return err
+}
+
+// SaveState replaces a symbol's saved state.
+func (s *Store) SaveState(st TraderState) error {
+	return saveState(s.DB, st)
+}
+
+// LogTradeWithState records a trade like LogTrade together with the trader
+// state after it, in one transaction, so neither is kept without the other.
+func (s *Store) LogTradeWithState(symbol, side string, amount, price, fee float64, at time.Time, st TraderState) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+        INSERT INTO transactions (symbol, side, amount, price, fee, time)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, symbol, side, amount, price, fee, at); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := saveState(tx, st); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// LoadStates returns the saved state of every symbol.
+func (s *Store) LoadStates() (map[string]TraderState, error) {
+	rows, err := s.DB.Query(`SELECT symbol, version, data, updated_ms FROM trader_state`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]TraderState)
+	for rows.Next() {
+		var st TraderState
+		var data string
+		var updated int64
+		if err := rows.Scan(&st.Symbol, &st.Version, &data, &updated); err != nil {
+			return nil, err
+		}
+		st.Data = []byte(data)
+		st.UpdatedAt = time.UnixMilli(updated)
+		states[st.Symbol] = st
+	}
+	return states, rows.Err()
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"time"
 )
@@ -23,6 +24,7 @@ func NewStore(path string) (*Store, error) {
         side TEXT,
         amount REAL,
         price REAL,
+        fee REAL,
         time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
     );`
 
@@ -30,15 +32,58 @@ func NewStore(path string) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
+	if _, err = db.Exec(historySchema); err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(ordersSchema); err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(stateSchema); err != nil {
+		return nil, err
+	}
+	if err = addColumn(db, "transactions", "fee", "REAL"); err != nil {
+		return nil, err
+	}
+	if err = addColumn(db, "order_fills", "commission_quote", "REAL"); err != nil {
+		return nil, err
+	}
 
 	return &Store{DB: db}, nil
 }
 
+// addColumn adds a column to a table created before the column existed.
+func addColumn(db *sql.DB, table, column, decl string) error {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+	return err
+}
+
 func (s *Store) LogTransaction(symbol, side string, amount, price float64) error {
+	return s.LogTransactionAt(symbol, side, amount, price, time.Now())
+}
+
+// LogTransactionAt records a trade with an explicit timestamp (used by backtests).
+// Its fee is not known.
+func (s *Store) LogTransactionAt(symbol, side string, amount, price float64, at time.Time) error {
 	_, err := s.DB.Exec(`
         INSERT INTO transactions (symbol, side, amount, price, time) 
         VALUES (?, ?, ?, ?, ?)
-    `, symbol, side, amount, price, time.Now())
+    `, symbol, side, amount, price, at)
+	return err
+}
+
+// LogTrade records a trade with the commission paid on it, in the quote
+// asset. For buys, amount is what was received after any commission taken
+// from it, so amount*price + fee is what the buy cost.
+func (s *Store) LogTrade(symbol, side string, amount, price, fee float64, at time.Time) error {
+	_, err := s.DB.Exec(`
+        INSERT INTO transactions (symbol, side, amount, price, fee, time)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, symbol, side, amount, price, fee, at)
 	return err
 }
 
@@ -61,7 +106,7 @@ func (s *Store) GetLastBuyTransaction(symbol string) (float64, float64, error) {
 
 func (s *Store) GetTransactions(symbol string, limit int) ([]Transaction, error) {
 	rows, err := s.DB.Query(`
-        SELECT side, amount, price, time
+        SELECT side, amount, price, fee, time
         FROM transactions
         WHERE symbol = ?
         ORDER BY time DESC
@@ -75,18 +120,50 @@ func (s *Store) GetTransactions(symbol string, limit int) ([]Transaction, error)
 	var result []Transaction
 	for rows.Next() {
 		var t Transaction
-		err := rows.Scan(&t.Side, &t.Amount, &t.Price, &t.Time)
+		var fee sql.NullFloat64
+		err := rows.Scan(&t.Side, &t.Amount, &t.Price, &fee, &t.Time)
 		if err != nil {
 			return nil, err
 		}
+		t.Fee, t.FeeRecorded = fee.Float64, fee.Valid
 		result = append(result, t)
 	}
 	return result, nil
 }
 
+// GetAllTransactions returns every trade for a symbol in chronological order.
+func (s *Store) GetAllTransactions(symbol string) ([]Transaction, error) {
+	rows, err := s.DB.Query(`
+        SELECT side, amount, price, fee, time
+        FROM transactions
+        WHERE symbol = ?
+        ORDER BY time ASC
+    `, symbol)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Transaction
+	for rows.Next() {
+		var t Transaction
+		var fee sql.NullFloat64
+		if err := rows.Scan(&t.Side, &t.Amount, &t.Price, &fee, &t.Time); err != nil {
+			return nil, err
+		}
+		t.Fee, t.FeeRecorded = fee.Float64, fee.Valid
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
 type Transaction struct {
 	Side   string
 	Amount float64
 	Price  float64
 	Time   time.Time
+	// Fee is the commission in the quote asset. Trades recorded before fees
+	// were tracked have FeeRecorded false.
+	Fee         float64
+	FeeRecorded bool
 }
@@ -0,0 +1,84 @@
+package strategy
+
+func init() {
+	Register(Default, func(e *StrategyEngine) Strategy { return &emaRSIBollinger{e: e} })
+}
+
+// emaRSIBollinger buys oversold dips near the lower Bollinger band, averages
+// down on further drops, and exits on a trailing stop or the engine's sell score.
+type emaRSIBollinger struct {
+	e *StrategyEngine
+}
+
+func (s *emaRSIBollinger) Decide(in Input) Decision {
+	buy := s.decideBuy(in)
+	if buy.Action == Buy || !in.Position.Holding || !in.Position.CanSell {
+		return buy
+	}
+	return s.decideSell(in)
+}
+
+func (s *emaRSIBollinger) decideBuy(in Input) Decision {
+	p := in.Position
+	price := in.Price
+
+	if p.Holding && p.Entries >= p.MaxEntries {
+		return hold("max entries reached (%d)", p.Entries)
+	}
+	if p.Holding && price > p.AverageBuyPrice*(1-s.e.DCADropPercent) {
+		return hold("price %.2f not %.1f%% below average buy %.2f", price, s.e.DCADropPercent*100, p.AverageBuyPrice)
+	}
+
+	// Așteaptă o scădere semnificativă după SELL
+	if !p.Holding && p.LastSellPrice > 0 && price > p.LastSellPrice*(1-s.e.ReentryDropPercent) {
+		return hold("waiting for price to drop after last SELL (%.2f → %.2f)", p.LastSellPrice, price)
+	}
+
+	// Bollinger Bands: cumpără doar în zona inferioară
+	if s.e.UseBollinger {
+		lower, _, _ := CalculateBollingerBands(in.History, s.e.BollingerWindow)
+		if limit := lower * (1 + s.e.BollingerBuyMargin); price > limit {
+			return hold("price not low enough in Bollinger band (%.2f > %.2f)", price, limit)
+		}
+	}
+
+	// RSI: trebuie să fie destul de jos
+	if rsi := s.e.CalculateRSI(in.History); rsi > s.e.MaxBuyRSI {
+		return hold("RSI too high for buy: %.2f", rsi)
+	}
+
+	if in.Spread > s.e.MaxSpread {
+		return hold("spread too high: %.4f", in.Spread)
+	}
+
+	return Decision{Action: Buy, Reasons: []string{"oversold near lower Bollinger band"}}
+}
+
+func (s *emaRSIBollinger) decideSell(in Input) Decision {
+	p := in.Position
+	price := in.Price
+	netProfit := s.e.NetProfit(price, p.AverageBuyPrice)
+
+	if netProfit < s.e.MinProfitMargin {
+		return hold("net profit %.2f%% below margin", netProfit*100)
+	}
+	if in.Spread > s.e.MaxSpread {
+		return hold("spread too high: %.4f", in.Spread)
+	}
+
+	if price < p.TrailingHigh*(1-s.e.TrailingStop(netProfit)) && confirmDownTrend(in.History) {
+		return Decision{Action: Sell, Reasons: []string{"trailing stop hit in a down trend"}}
+	}
+	if s.e.ShouldSell(price, p.AverageBuyPrice, in.History) {
+		return Decision{Action: Sell, Reasons: []string{"sell score reached"}}
+	}
+	return hold("no sell signal")
+}
+
+func confirmDownTrend(history []float64) bool {
+	if len(history) < 3 {
+		return false
+	}
+	return history[len(history)-1] < history[len(history)-2] &&
+		history[len(history)-2] < history[len(history)-3]
+}
@@ -0,0 +1,29 @@
+package strategy
+
+func init() {
+	Register("ema-score", func(e *StrategyEngine) Strategy { return &emaScore{e: e} })
+}
+
+// emaScore enters on a confirmed local bottom with a strong buy score and
+// exits on the engine's stop-loss, max-hold and sell-score rules. It never
+// averages down.
+type emaScore struct {
+	e *StrategyEngine
+}
+
+func (s *emaScore) Decide(in Input) Decision {
+	p := in.Position
+	if in.Spread > s.e.MaxSpread {
+		return hold("spread too high: %.4f", in.Spread)
+	}
+	if !p.Holding {
+		if s.e.ShouldBuy(in.Price, in.History, p.LastSellPrice) {
+			return Decision{Action: Buy, Reasons: []string{"buy score reached"}}
+		}
+		return hold("no buy signal")
+	}
+	if p.CanSell && s.e.ShouldSell(in.Price, p.AverageBuyPrice, in.History) {
+		return Decision{Action: Sell, Reasons: []string{"sell score reached"}}
+	}
+	return hold("no sell signal")
+}
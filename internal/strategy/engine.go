@@ -3,7 +3,10 @@ package strategy
 import (
 	"fmt"
 	"math"
+	"sort"
 	"time"
+
+	"traderider/internal/clock"
 )
 
 type FeatureVector struct {
@@ -35,6 +38,52 @@ type StrategyEngine struct {
 	CommissionRate     float64
 	UseBollinger       bool
 	BollingerWindow    int
+	// ReentryDropPercent is how far price must fall below the last sell before buying again.
+	ReentryDropPercent float64
+	// DCADropPercent is how far below the average buy price another entry is added.
+	DCADropPercent float64
+	MaxBuyRSI      float64
+	// BollingerBuyMargin allows buys up to this fraction above the lower band.
+	BollingerBuyMargin float64
+	MaxSpread          float64
+	TrailingStops      []TrailingStop
+	Clock              clock.Clock
+}
+
+// TrailingStop is one tier of the dynamic trailing stop: once net profit
+// reaches MinProfit, sell if price falls Stop below the trailing high.
+type TrailingStop struct {
+	MinProfit float64 `yaml:"min_profit" json:"minProfit"`
+	Stop      float64 `yaml:"stop" json:"stop"`
+}
+
+// DefaultTrailingStops tightens the stop as profit grows.
+var DefaultTrailingStops = []TrailingStop{
+	{MinProfit: 0, Stop: 0.035},
+	{MinProfit: 0.01, Stop: 0.025},
+	{MinProfit: 0.015, Stop: 0.02},
+	{MinProfit: 0.03, Stop: 0.015},
+	{MinProfit: 0.06, Stop: 0.012},
+}
+
+// State is what the engine remembers of past trades; it is saved across
+// restarts with the trader's state.
+type State struct {
+	LastBuyTime    time.Time
+	LastSellTime   time.Time
+	LastSellProfit float64
+}
+
+// State returns the engine's trade memory.
+func (s *StrategyEngine) State() State {
+	return State{LastBuyTime: s.LastBuyTime, LastSellTime: s.LastSellTime, LastSellProfit: s.LastSellProfit}
+}
+
+// Restore sets the engine's trade memory from a saved State.
+func (s *StrategyEngine) Restore(st State) {
+	s.LastBuyTime = st.LastBuyTime
+	s.LastSellTime = st.LastSellTime
+	s.LastSellProfit = st.LastSellProfit
 }
 
 func NewEngine(shortWindow, longWindow int, minProfitMargin float64) *StrategyEngine {
@@ -49,7 +98,42 @@ func NewEngine(shortWindow, longWindow int, minProfitMargin float64) *StrategyEn
 		CommissionRate:     0.001,
 		UseBollinger:       true,
 		BollingerWindow:    20,
+		ReentryDropPercent: 0.005,
+		DCADropPercent:     0.04,
+		MaxBuyRSI:          40,
+		BollingerBuyMargin: 0.02,
+		MaxSpread:          0.002,
+		TrailingStops:      DefaultTrailingStops,
+		Clock:              clock.Real{},
+	}
+}
+
+func (s *StrategyEngine) since(t time.Time) time.Duration {
+	return s.Clock.Now().Sub(t)
+}
+
+// NetProfit is the relative profit of selling at price. buyPrice is the
+// average cost including the fees already paid on the buys; the sell fee is
+// estimated from CommissionRate.
+func (s *StrategyEngine) NetProfit(price, buyPrice float64) float64 {
+	return (price*(1-s.CommissionRate) - buyPrice) / buyPrice
+}
+
+// TrailingStop returns the stop distance for the highest tier whose MinProfit
+// netProfit has reached. The lowest tier also applies below its threshold.
+func (s *StrategyEngine) TrailingStop(netProfit float64) float64 {
+	tiers := append([]TrailingStop{}, s.TrailingStops...)
+	if len(tiers) == 0 {
+		tiers = DefaultTrailingStops
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinProfit < tiers[j].MinProfit })
+	stop := tiers[0].Stop
+	for _, t := range tiers {
+		if netProfit >= t.MinProfit {
+			stop = t.Stop
+		}
 	}
+	return stop
 }
 
 func (s *StrategyEngine) ShouldBuy(price float64, history []float64, lastSellPrice float64) bool {
@@ -58,8 +142,8 @@ func (s *StrategyEngine) ShouldBuy(price float64, history []float64, lastSellPri
 	}
 
 	// Așteaptă o scădere reală după vânzare
-	if lastSellPrice > 0 && price > lastSellPrice*(1-0.005) {
-		fmt.Printf("[STRATEGY] Waiting for price to drop further after last SELL (%.2f > %.2f)\n", price, lastSellPrice*(1-0.005))
+	if lastSellPrice > 0 && price > lastSellPrice*(1-s.ReentryDropPercent) {
+		fmt.Printf("[STRATEGY] Waiting for price to drop further after last SELL (%.2f > %.2f)\n", price, lastSellPrice*(1-s.ReentryDropPercent))
 		return false
 	}
 
@@ -90,12 +174,12 @@ func (s *StrategyEngine) ShouldSell(price, buyPrice float64, history []float64)
 		return false
 	}
 
-	netProfit := ((price * (1 - s.CommissionRate)) - (buyPrice * (1 + s.CommissionRate))) / buyPrice
-	holdingTime := time.Since(s.LastBuyTime)
+	netProfit := s.NetProfit(price, buyPrice)
+	holdingTime := s.since(s.LastBuyTime)
 
 	if netProfit < -s.SoftStopLoss && holdingTime > time.Hour {
 		fmt.Printf("[STRATEGY] Stop-loss triggered: %.2f%%\n", netProfit*100)
-		s.LastSellTime = time.Now()
+		s.LastSellTime = s.Clock.Now()
 		s.LastSellProfit = netProfit * 100
 		return true
 	}
@@ -105,7 +189,7 @@ func (s *StrategyEngine) ShouldSell(price, buyPrice float64, history []float64)
 		features := s.extractFeatures(price, history, buyPrice)
 		if netProfit < 0.01 && features.EMAShort < features.EMALong && features.RSI < 45 {
 			fmt.Printf("[STRATEGY] Weak trend + low profit after max hold\n")
-			s.LastSellTime = time.Now()
+			s.LastSellTime = s.Clock.Now()
 			s.LastSellProfit = netProfit * 100
 			return true
 		}
@@ -114,7 +198,7 @@ func (s *StrategyEngine) ShouldSell(price, buyPrice float64, history []float64)
 	features := s.extractFeatures(price, history, buyPrice)
 	score := s.sellScore(features, netProfit)
 	if score > 1.2 {
-		s.LastSellTime = time.Now()
+		s.LastSellTime = s.Clock.Now()
 		s.LastSellProfit = netProfit * 100
 		return true
 	}
@@ -145,7 +229,7 @@ func (s *StrategyEngine) extractFeatures(price float64, history []float64, refPr
 		BandUpper:   bandUpper,
 		BandWidth:   bandUpper - bandLower,
 		LastSellGap: gap,
-		TimeOK:      time.Since(s.LastSellTime) > 3*time.Minute || s.LastSellProfit >= 0.5,
+		TimeOK:      s.since(s.LastSellTime) > 3*time.Minute || s.LastSellProfit >= 0.5,
 	}
 }
 
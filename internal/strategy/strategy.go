@@ -0,0 +1,113 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Action int
+
+const (
+	Hold Action = iota
+	Buy
+	Sell
+)
+
+func (a Action) String() string {
+	switch a {
+	case Buy:
+		return "BUY"
+	case Sell:
+		return "SELL"
+	default:
+		return "HOLD"
+	}
+}
+
+// Decision is what a strategy wants to do on this tick and why.
+type Decision struct {
+	Action  Action
+	Reasons []string
+}
+
+func hold(format string, args ...interface{}) Decision {
+	return Decision{Action: Hold, Reasons: []string{fmt.Sprintf(format, args...)}}
+}
+
+// Position is the trader's view of what it currently holds.
+type Position struct {
+	Holding         bool
+	Entries         int
+	MaxEntries      int
+	AverageBuyPrice float64
+	TrailingHigh    float64
+	LastSellPrice   float64
+	HoldingTime     time.Duration
+	// CanSell is false until the trader's minimum holding time has passed.
+	CanSell bool
+}
+
+// Input is everything a strategy sees on a tick.
+type Input struct {
+	Symbol   string
+	Price    float64
+	Spread   float64
+	History  []float64
+	Position Position
+}
+
+// Strategy turns market data and the current position into a decision.
+// Sizing, balances and order execution stay with the trader.
+type Strategy interface {
+	Decide(in Input) Decision
+}
+
+// Factory builds a strategy around a symbol's engine, which holds the
+// indicator parameters and timing state.
+type Factory func(e *StrategyEngine) Strategy
+
+// Default is used when a symbol does not name a strategy.
+const Default = "ema-rsi-bollinger"
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a strategy selectable by name in the config.
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("strategy: Register called twice for " + name)
+	}
+	registry[name] = f
+}
+
+// New builds the named strategy, or the default one when name is empty.
+func New(name string, e *StrategyEngine) (Strategy, error) {
+	if name == "" {
+		name = Default
+	}
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q (available: %v)", name, Names())
+	}
+	return f(e), nil
+}
+
+// Names lists the registered strategies.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
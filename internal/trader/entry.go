@@ -0,0 +1,124 @@
+package trader
+
+import (
+	"fmt"
+	"time"
+
+	"traderider/internal/exchange"
+)
+
+const (
+	// EntryMarket buys with market orders.
+	EntryMarket = "market"
+	// EntryMaker rests post-only limit buys at the best bid to pay maker fees
+	// and no spread.
+	EntryMaker = "maker"
+)
+
+// pendingEntry is a post-only buy resting on the book. The investment stays
+// reserved in the wallet until it fills or is abandoned.
+type pendingEntry struct {
+	orderID  int64
+	price    float64
+	placedAt time.Time
+	reprices int
+}
+
+// placeEntry rests a post-only buy at the best bid. If it cannot be placed,
+// for example because the book moved through the price, the entry is abandoned.
+func (t *Trader) placeEntry(lo exchange.LimitOrderer, quantity float64, reprices int) {
+	bid, _, err := t.mw.GetBidAsk(t.Symbol)
+	if err == nil {
+		var order *exchange.Order
+		rec := t.recordIntent(exchange.SideBuy, exchange.OrderTypeLimitMaker, t.buyReason(), quantity, bid, 0)
+		order, err = lo.LimitOrder(t.Symbol, exchange.SideBuy, quantity, bid, true)
+		t.recordResult(rec, order, err)
+		if err == nil {
+			t.entry = &pendingEntry{orderID: order.OrderID, price: order.Price, placedAt: t.clock.Now(), reprices: reprices}
+			fmt.Printf("[ENTRY] [%s] Post-only buy %.6f @ %.4f (order %d)\n", t.Symbol, order.OrigQty, order.Price, order.OrderID)
+			return
+		}
+	}
+	fmt.Printf("[ENTRY] [%s] Post-only buy not placed: %v\n", t.Symbol, err)
+	t.abandonEntry()
+}
+
+// checkEntry follows the resting entry: fills are booked, and an order still
+// open after makerTimeout is cancelled and re-placed at the new best bid, up
+// to makerMaxReprices times.
+func (t *Trader) checkEntry() {
+	lo := t.ex.(exchange.LimitOrderer)
+	order, err := lo.GetOrder(t.Symbol, t.entry.orderID)
+	if err != nil {
+		fmt.Printf("[ENTRY] [%s] Failed to query order %d: %v\n", t.Symbol, t.entry.orderID, err)
+		return
+	}
+	t.trackOrder(order)
+	if order.IsOpen() {
+		if t.since(t.entry.placedAt) < t.makerTimeout {
+			return
+		}
+		// The order may fill between the query and the cancel; the next
+		// query will then report it as filled.
+		order, err = lo.CancelOrder(t.Symbol, t.entry.orderID)
+		if err != nil {
+			fmt.Printf("[ENTRY] [%s] Failed to cancel order %d: %v\n", t.Symbol, t.entry.orderID, err)
+			return
+		}
+		t.trackOrder(order)
+	}
+
+	entry := t.entry
+	t.entry = nil
+	if order.ExecutedQty > 0 {
+		t.recordBuy(order)
+		return
+	}
+	if order.Status == exchange.StatusExpired || order.Status == exchange.StatusRejected {
+		fmt.Printf("[ENTRY] [%s] Buy order %d %s by the exchange\n", t.Symbol, order.OrderID, order.Status)
+	}
+	if entry.reprices < t.makerMaxReprices {
+		amount, err := t.ex.CalculateBuyQty(t.Symbol, t.reserved)
+		if err == nil && amount > 0 {
+			fmt.Printf("[ENTRY] [%s] Re-pricing unfilled buy (%d/%d)\n", t.Symbol, entry.reprices+1, t.makerMaxReprices)
+			t.placeEntry(lo, amount, entry.reprices+1)
+			return
+		}
+	}
+	t.abandonEntry()
+}
+
+// abandonEntry buys at market when configured, otherwise releases the reserved investment.
+func (t *Trader) abandonEntry() {
+	if t.makerFallbackMarket {
+		amount, err := t.ex.CalculateBuyQty(t.Symbol, t.reserved)
+		if err == nil && amount > 0 {
+			fmt.Printf("[ENTRY] [%s] Falling back to market buy\n", t.Symbol)
+			t.marketBuy(amount)
+			return
+		}
+	}
+	t.settleReserved(0)
+}
+
+// cancelEntry cancels a resting entry, booking whatever already filled.
+func (t *Trader) cancelEntry() {
+	if t.entry == nil {
+		return
+	}
+	lo := t.ex.(exchange.LimitOrderer)
+	order, err := lo.CancelOrder(t.Symbol, t.entry.orderID)
+	if err != nil {
+		if order, err = lo.GetOrder(t.Symbol, t.entry.orderID); err != nil {
+			fmt.Printf("[ENTRY] [%s] Failed to cancel order %d: %v\n", t.Symbol, t.entry.orderID, err)
+			return
+		}
+	}
+	t.trackOrder(order)
+	t.entry = nil
+	if order.ExecutedQty > 0 {
+		t.recordBuy(order)
+		return
+	}
+	t.settleReserved(0)
+}
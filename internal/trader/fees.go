@@ -0,0 +1,50 @@
+package trader
+
+import "traderider/internal/exchange"
+
+// orderFee is the commission paid on an executed order, in the quote asset.
+// An order without fills is assumed to have paid the configured commission
+// rate.
+func (t *Trader) orderFee(order *exchange.Order) float64 {
+	if len(order.Fills) == 0 {
+		return order.ExecutedQty * order.AvgPrice() * t.se.CommissionRate
+	}
+	fee := 0.0
+	for _, f := range order.Fills {
+		fee += t.fillFee(f)
+	}
+	return fee
+}
+
+// fillFee values a fill's commission in the quote asset: base-asset fees at
+// the fill price, and fees in a third asset such as BNB at that asset's
+// current rate against the quote. A fee that cannot be valued because the
+// exchange lists no such pair is assumed to be the configured commission
+// rate.
+func (t *Trader) fillFee(f exchange.Fill) float64 {
+	switch f.CommissionAsset {
+	case t.quoteAsset(), "":
+		return f.Commission
+	case t.baseAsset():
+		return f.Commission * f.Price
+	}
+	if rate := t.feeRate(f.CommissionAsset); rate > 0 {
+		return f.Commission * rate
+	}
+	return f.Price * f.Qty * t.se.CommissionRate
+}
+
+// feeRate returns the quote value of one unit of a commission asset. Rates
+// are kept until the next tick so that an order with many fills looks the
+// pair up once.
+func (t *Trader) feeRate(asset string) float64 {
+	if rate, ok := t.feeRates[asset]; ok {
+		return rate
+	}
+	rate := exchange.ConversionRate(t.ex, asset, t.quoteAsset())
+	if t.feeRates == nil {
+		t.feeRates = make(map[string]float64)
+	}
+	t.feeRates[asset] = rate
+	return rate
+}
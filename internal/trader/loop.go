@@ -0,0 +1,154 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStopped is returned by commands sent to a trader whose Run loop has ended.
+var ErrStopped = errors.New("trader stopped")
+
+// tickInterval is how often Run evaluates the market.
+var tickInterval = 5 * time.Second
+
+// Run owns the trader once started: it ticks every tickInterval and, between
+// ticks, executes the commands other goroutines send through ForceSell,
+// SetInvestmentPerTrade, SetMode, SellAndStop and the state accessors, so all
+// state changes happen on one goroutine. A paused or stopped trader does not
+// tick but still serves commands. Commands sent before Run starts run on the
+// caller's goroutine.
+//
+// After Drain, Run no longer ticks but still serves commands. When ctx is
+// done Run lets the current tick or command finish, so orders in flight are
+// booked, cancels a resting entry and returns. Commands sent once ctx is done
+// fail with ErrStopped.
+func (t *Trader) Run(ctx context.Context) {
+	t.startMu.Lock()
+	t.started = true
+	t.startMu.Unlock()
+	defer close(t.done)
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.cancelEntry()
+			fmt.Printf("[SHUTDOWN] [%s] Trader stopped\n", t.Symbol)
+			return
+		case cmd := <-t.cmds:
+			cmd(ctx.Err() != nil)
+		case <-ticker.C:
+			// No new trades once shutdown has begun.
+			if t.mode == ModePaused || t.mode == ModeStopped || t.draining.Load() || ctx.Err() != nil {
+				continue
+			}
+			t.Tick()
+		}
+	}
+}
+
+// Drain stops Run from ticking, so no new trades start, while it keeps
+// serving commands until its context is done. Shutdown drains the traders
+// before finishing the API requests in progress.
+func (t *Trader) Drain() {
+	t.draining.Store(true)
+}
+
+// do runs fn on the Run goroutine and waits for it, or runs it directly if
+// Run has not been started. Commands fail with ErrStopped once Run is
+// stopping.
+func (t *Trader) do(fn func()) error {
+	t.startMu.Lock()
+	if !t.started {
+		defer t.startMu.Unlock()
+		fn()
+		return nil
+	}
+	t.startMu.Unlock()
+
+	result := make(chan error, 1)
+	cmd := func(stopping bool) {
+		if stopping {
+			result <- ErrStopped
+			return
+		}
+		fn()
+		result <- nil
+	}
+	select {
+	case t.cmds <- cmd:
+	case <-t.done:
+		return ErrStopped
+	}
+	return <-result
+}
+
+// view runs a read-only fn like do, or directly once Run has ended and
+// nothing changes the state any more.
+func (t *Trader) view(fn func()) {
+	if err := t.do(fn); err != nil {
+		<-t.done
+		fn()
+	}
+}
+
+// ForceSell cancels any entry and protection and sells the position at market.
+func (t *Trader) ForceSell() error {
+	var err error
+	if cmdErr := t.do(func() { err = t.forceSell() }); cmdErr != nil {
+		return cmdErr
+	}
+	return err
+}
+
+// SetInvestmentPerTrade changes the quote amount of future buys.
+func (t *Trader) SetInvestmentPerTrade(amount float64) error {
+	return t.do(func() { t.investmentPerTrade = amount })
+}
+
+// Summary returns the position and profit figures valued at price.
+func (t *Trader) Summary(price float64) map[string]float64 {
+	var s map[string]float64
+	t.view(func() { s = t.summary(price) })
+	return s
+}
+
+// SnapshotState returns the state to save across restarts.
+func (t *Trader) SnapshotState() StateSnapshot {
+	var s StateSnapshot
+	t.view(func() { s = t.snapshotState() })
+	return s
+}
+
+// Reconciliation returns a copy of the last reconciliation, or nil if there
+// was none.
+func (t *Trader) Reconciliation() *Reconciliation {
+	var r *Reconciliation
+	t.view(func() { r = t.reconciliation.copy() })
+	return r
+}
+
+// Acknowledge accepts the exchange balance as the position despite the
+// reported issues and lets the symbol trade again. Orders whose outcome is
+// unknown are written off; unknown open orders stay on the exchange.
+func (t *Trader) Acknowledge() error {
+	var err error
+	if cmdErr := t.do(func() { err = t.acknowledge() }); cmdErr != nil {
+		return cmdErr
+	}
+	return err
+}
+
+// ReconcileAgain checks the current state like Reconcile does at startup,
+// e.g. after stray orders were cancelled by hand.
+func (t *Trader) ReconcileAgain() (*Reconciliation, error) {
+	var r *Reconciliation
+	err := t.do(func() {
+		s := t.snapshotState()
+		r = t.Reconcile(&s).copy()
+	})
+	return r, err
+}
@@ -0,0 +1,250 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"traderider/internal/exchange"
+	"traderider/internal/market"
+	"traderider/internal/notifier"
+	"traderider/internal/paper"
+	"traderider/internal/store"
+	"traderider/internal/strategy"
+	"traderider/internal/wallet"
+)
+
+const testSymbol = "BTCUSDC"
+
+// testFeed prices the paper exchange; it has no filters beyond the assets.
+type testFeed struct {
+	mu    sync.Mutex
+	price float64
+}
+
+func (f *testFeed) GetSymbolPrice(symbol string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.price
+}
+
+func (f *testFeed) GetSpread(symbol string) float64 { return 0.0001 }
+
+func (f *testFeed) GetSymbolFilter(symbol string) exchange.SymbolFilter {
+	return exchange.SymbolFilter{BaseAsset: "BTC", QuoteAsset: "USDC"}
+}
+
+func (f *testFeed) set(price float64) {
+	f.mu.Lock()
+	f.price = price
+	f.mu.Unlock()
+}
+
+type testEnv struct {
+	tr   *Trader
+	ex   *paper.Exchange
+	feed *testFeed
+	mw   *market.MarketWatcher
+	wm   *wallet.WalletManager
+	db   *store.Store
+}
+
+// newTestEnv builds a trader for testSymbol on a paper exchange holding
+// balances, with its store in a temporary directory.
+func newTestEnv(t *testing.T, balances map[string]float64) *testEnv {
+	t.Helper()
+	db, err := store.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	feed := &testFeed{price: 50000}
+	ex := paper.NewExchange(feed, paper.Config{StartingBalances: balances, CommissionRate: 0.001})
+	mw := market.NewWatcher(ex)
+	mw.Record(testSymbol, feed.price, time.Now())
+	n := notifier.NewWhatsAppNotifier("", "")
+	wm := wallet.NewWalletManager(ex, n, "USDC")
+	wm.Update()
+
+	tr := NewTrader(db, mw, strategy.NewEngine(5, 20, 0.01), Config{InvestmentPerTrade: 100}, ex, wm, n)
+	tr.Symbol = testSymbol
+	return &testEnv{tr: tr, ex: ex, feed: feed, mw: mw, wm: wm, db: db}
+}
+
+// start runs the trader until the returned stop is called or the test ends.
+// It returns once Run has started; stop returns once Run has ended.
+func (e *testEnv) start(t *testing.T) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	go e.tr.Run(ctx)
+	waitStarted(e.tr)
+	stop = func() {
+		cancel()
+		<-e.tr.done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// waitStarted waits until Run has started, so commands go through it rather
+// than running directly.
+func waitStarted(tr *Trader) {
+	for {
+		tr.startMu.Lock()
+		started := tr.started
+		tr.startMu.Unlock()
+		if started {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func withTickInterval(t *testing.T, d time.Duration) {
+	t.Helper()
+	prev := tickInterval
+	tickInterval = d
+	t.Cleanup(func() { tickInterval = prev })
+}
+
+func TestRunSerializesConcurrentCommands(t *testing.T) {
+	withTickInterval(t, time.Millisecond)
+	e := newTestEnv(t, map[string]float64{"USDC": 1000, "BTC": 0.01})
+	e.tr.RestoreState(StateSnapshot{AssetHeld: 0.01, USDCInvested: 490, AverageBuyPrice: 49000, Holding: true, Entries: 1})
+	stop := e.start(t)
+
+	var wg sync.WaitGroup
+	run := func(n int, fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				fn(i)
+			}
+		}()
+	}
+	run(5, func(int) {
+		if err := e.tr.ForceSell(); err != nil {
+			t.Errorf("ForceSell: %v", err)
+		}
+	})
+	run(200, func(i int) {
+		price := 50000 + float64(i%20)*10
+		e.feed.set(price)
+		e.mw.Record(testSymbol, price, time.Now())
+		e.wm.Update()
+	})
+	run(200, func(int) { e.tr.Summary(e.feed.GetSymbolPrice(testSymbol)) })
+	run(200, func(int) { e.tr.SnapshotState() })
+	run(50, func(int) {
+		if err := e.tr.SaveState(); err != nil {
+			t.Errorf("SaveState: %v", err)
+		}
+	})
+	run(100, func(i int) {
+		if err := e.tr.SetInvestmentPerTrade(float64(100 + i)); err != nil {
+			t.Errorf("SetInvestmentPerTrade: %v", err)
+		}
+	})
+	wg.Wait()
+	stop()
+
+	s := e.tr.SnapshotState()
+	held, _ := e.ex.GetAssetBalance("BTC")
+	if math.Abs(s.AssetHeld-held) > 1e-9 {
+		t.Errorf("trader holds %v BTC, exchange %v", s.AssetHeld, held)
+	}
+	if s.InvestmentPerTrade != 199 {
+		t.Errorf("InvestmentPerTrade = %v, want 199", s.InvestmentPerTrade)
+	}
+	states, err := LoadStates(e.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := states[testSymbol]; !ok {
+		t.Errorf("no saved state for %s", testSymbol)
+	}
+}
+
+func TestCommandsAfterCancelReturnErrStopped(t *testing.T) {
+	e := newTestEnv(t, map[string]float64{"USDC": 1000})
+	ctx, cancel := context.WithCancel(context.Background())
+	go e.tr.Run(ctx)
+	waitStarted(e.tr)
+	if err := e.tr.SetInvestmentPerTrade(200); err != nil {
+		t.Fatalf("SetInvestmentPerTrade while running: %v", err)
+	}
+
+	cancel()
+	// Run may not have noticed the cancellation yet; commands are refused
+	// either way.
+	if err := e.tr.SetInvestmentPerTrade(300); !errors.Is(err, ErrStopped) {
+		t.Errorf("SetInvestmentPerTrade after cancel = %v, want ErrStopped", err)
+	}
+	<-e.tr.done
+	if err := e.tr.ForceSell(); !errors.Is(err, ErrStopped) {
+		t.Errorf("ForceSell after Run = %v, want ErrStopped", err)
+	}
+	if err := e.tr.SetMode(ModePaused); !errors.Is(err, ErrStopped) {
+		t.Errorf("SetMode after Run = %v, want ErrStopped", err)
+	}
+	if got := e.tr.SnapshotState().InvestmentPerTrade; got != 200 {
+		t.Errorf("InvestmentPerTrade = %v, want 200", got)
+	}
+}
+
+func TestDrainStopsTicksButServesCommands(t *testing.T) {
+	withTickInterval(t, time.Millisecond)
+	e := newTestEnv(t, map[string]float64{"USDC": 1000})
+	e.tr.Drain()
+	e.start(t)
+
+	time.Sleep(50 * time.Millisecond)
+	if err := e.tr.SetInvestmentPerTrade(150); err != nil {
+		t.Fatalf("SetInvestmentPerTrade while draining: %v", err)
+	}
+	// The first tick sets the daily start value.
+	var ticked bool
+	if err := e.tr.do(func() { ticked = e.tr.dailyStartValue != 0 }); err != nil {
+		t.Fatal(err)
+	}
+	if ticked {
+		t.Error("drained trader ticked")
+	}
+	if got := e.tr.SnapshotState().InvestmentPerTrade; got != 150 {
+		t.Errorf("InvestmentPerTrade = %v, want 150", got)
+	}
+}
+
+func TestCommandsBeforeRunRunDirectly(t *testing.T) {
+	e := newTestEnv(t, map[string]float64{"USDC": 1000})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := e.tr.SetInvestmentPerTrade(150); err != nil {
+			t.Errorf("SetInvestmentPerTrade: %v", err)
+		}
+		if err := e.tr.SetMode(ModePaused); err != nil {
+			t.Errorf("SetMode: %v", err)
+		}
+		s := e.tr.SnapshotState()
+		if s.InvestmentPerTrade != 150 || s.Mode != ModePaused {
+			t.Errorf("snapshot = %+v", s)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("commands blocked without Run")
+	}
+
+	e.start(t)
+	if got := e.tr.Mode(); got != ModePaused {
+		t.Errorf("Mode() once running = %q, want %q", got, ModePaused)
+	}
+}
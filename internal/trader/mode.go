@@ -0,0 +1,77 @@
+package trader
+
+import "fmt"
+
+// Trader modes, set through SetMode or SellAndStop and saved with the state.
+const (
+	// ModeActive trades normally.
+	ModeActive = "active"
+	// ModeNoEntries manages the position, including its exits and
+	// protection, but places no buys, neither entries nor DCA. A resting
+	// entry is cancelled.
+	ModeNoEntries = "no-entries"
+	// ModePaused does nothing at all; protective orders stay on the
+	// exchange, a resting entry is cancelled.
+	ModePaused = "paused"
+	// ModeStopped is a trader whose position was sold by SellAndStop. Like a
+	// paused one, it waits to be resumed.
+	ModeStopped = "stopped"
+)
+
+func validMode(mode string) bool {
+	switch mode {
+	case ModeActive, ModeNoEntries, ModePaused, ModeStopped:
+		return true
+	}
+	return false
+}
+
+// Mode returns the trader's current mode.
+func (t *Trader) Mode() string {
+	var mode string
+	t.view(func() { mode = t.mode })
+	return mode
+}
+
+// SetMode switches to ModeActive, ModeNoEntries or ModePaused and saves the
+// state, so the mode survives a restart.
+func (t *Trader) SetMode(mode string) error {
+	if mode == ModeStopped || !validMode(mode) {
+		return fmt.Errorf("invalid mode %q", mode)
+	}
+	var err error
+	if cmdErr := t.do(func() { err = t.setMode(mode) }); cmdErr != nil {
+		return cmdErr
+	}
+	return err
+}
+
+// SellAndStop stops the trader and sells its position at market. It stays
+// stopped even if the sell fails, so nothing is bought back meanwhile.
+func (t *Trader) SellAndStop() error {
+	var err error
+	if cmdErr := t.do(func() {
+		saveErr := t.setMode(ModeStopped)
+		if err = t.forceSell(); err == nil {
+			err = saveErr
+		}
+	}); cmdErr != nil {
+		return cmdErr
+	}
+	return err
+}
+
+// setMode switches mode and saves the state. Leaving ModeActive cancels a
+// resting entry: it would otherwise fill unmanaged, or as a new entry.
+func (t *Trader) setMode(mode string) error {
+	if mode != ModeActive {
+		t.cancelEntry()
+	}
+	if t.mode != mode {
+		msg := fmt.Sprintf("[MODE] [%s] %s -> %s", t.Symbol, t.mode, mode)
+		fmt.Println(msg)
+		t.notifier.Send(msg)
+	}
+	t.mode = mode
+	return t.saveState()
+}
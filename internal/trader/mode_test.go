@@ -0,0 +1,102 @@
+package trader
+
+import "testing"
+
+func TestSetModeRejectsStoppedAndUnknown(t *testing.T) {
+	e := newTestEnv(t, map[string]float64{"USDC": 1000})
+	e.start(t)
+	for _, mode := range []string{ModeStopped, "sleeping"} {
+		if err := e.tr.SetMode(mode); err == nil {
+			t.Errorf("SetMode(%q) succeeded", mode)
+		}
+	}
+	if got := e.tr.Mode(); got != ModeActive {
+		t.Errorf("Mode() = %q, want %q", got, ModeActive)
+	}
+}
+
+func TestSetModeCancelsRestingEntry(t *testing.T) {
+	for _, mode := range []string{ModeNoEntries, ModePaused} {
+		t.Run(mode, func(t *testing.T) {
+			e := newTestEnv(t, map[string]float64{"USDC": 1000})
+			e.tr.placeEntry(e.ex, 0.001, 0)
+			if e.tr.entry == nil {
+				t.Fatal("entry not placed")
+			}
+			e.start(t)
+
+			if err := e.tr.SetMode(mode); err != nil {
+				t.Fatal(err)
+			}
+			open, err := e.ex.GetOpenOrders(testSymbol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(open) != 0 {
+				t.Errorf("%d orders still open", len(open))
+			}
+			if usdc, _ := e.ex.GetAssetBalance("USDC"); usdc != 1000 {
+				t.Errorf("USDC balance = %v, want 1000", usdc)
+			}
+		})
+	}
+}
+
+func TestModeSurvivesRestart(t *testing.T) {
+	e := newTestEnv(t, map[string]float64{"USDC": 1000})
+	stop := e.start(t)
+	if err := e.tr.SetMode(ModePaused); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	states, err := LoadStates(e.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := states[testSymbol]
+	if !ok {
+		t.Fatalf("no saved state for %s", testSymbol)
+	}
+	if s.Mode != ModePaused {
+		t.Errorf("saved mode = %q, want %q", s.Mode, ModePaused)
+	}
+
+	restarted := newTestEnv(t, map[string]float64{"USDC": 1000})
+	restarted.tr.RestoreState(s)
+	restarted.start(t)
+	if got := restarted.tr.Mode(); got != ModePaused {
+		t.Errorf("restored mode = %q, want %q", got, ModePaused)
+	}
+}
+
+func TestSellAndStop(t *testing.T) {
+	e := newTestEnv(t, map[string]float64{"USDC": 1000, "BTC": 0.01})
+	e.tr.RestoreState(StateSnapshot{AssetHeld: 0.01, USDCInvested: 490, AverageBuyPrice: 49000, Holding: true, Entries: 1})
+	e.start(t)
+
+	if err := e.tr.SellAndStop(); err != nil {
+		t.Fatal(err)
+	}
+	if btc, _ := e.ex.GetAssetBalance("BTC"); btc != 0 {
+		t.Errorf("BTC balance = %v after SellAndStop", btc)
+	}
+	s := e.tr.SnapshotState()
+	if s.Mode != ModeStopped || s.AssetHeld != 0 {
+		t.Errorf("mode %q holding %v, want stopped and flat", s.Mode, s.AssetHeld)
+	}
+	states, err := LoadStates(e.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := states[testSymbol].Mode; got != ModeStopped {
+		t.Errorf("saved mode = %q, want %q", got, ModeStopped)
+	}
+
+	if err := e.tr.SetMode(ModeActive); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.tr.Mode(); got != ModeActive {
+		t.Errorf("Mode() after resume = %q, want %q", got, ModeActive)
+	}
+}
@@ -0,0 +1,197 @@
+package trader
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"traderider/internal/exchange"
+	"traderider/internal/store"
+)
+
+// Reasons recorded with each order the trader places.
+const (
+	reasonEntry      = "entry"
+	reasonDCA        = "dca"
+	reasonExit       = "exit"
+	reasonForceSell  = "force-sell"
+	reasonProtection = "protection"
+)
+
+// buyReason tells an opening buy from one that adds to the position.
+func (t *Trader) buyReason() string {
+	if t.holding {
+		return reasonDCA
+	}
+	return reasonEntry
+}
+
+// recordIntent stores an order the trader is about to send, opening a
+// position for it if there is none. It returns nil if the order could not
+// be recorded; trading goes on regardless.
+func (t *Trader) recordIntent(side, typ, reason string, quantity, price, stopPrice float64) *store.OrderRecord {
+	if t.positionID == 0 {
+		id, err := t.db.OpenPosition(t.Symbol, t.clock.Now())
+		if err != nil {
+			fmt.Printf("[ORDERS] [%s] Failed to open position: %v\n", t.Symbol, err)
+		}
+		t.positionID = id
+	}
+	r := &store.OrderRecord{
+		PositionID: t.positionID,
+		Symbol:     t.Symbol,
+		Side:       side,
+		Type:       typ,
+		Reason:     reason,
+		Price:      price,
+		StopPrice:  stopPrice,
+		OrigQty:    quantity,
+		CreatedAt:  t.clock.Now(),
+	}
+	if err := t.db.CreateOrder(r); err != nil {
+		fmt.Printf("[ORDERS] [%s] Failed to record %s %s: %v\n", t.Symbol, typ, side, err)
+		return nil
+	}
+	return r
+}
+
+// recordResult stores the exchange's answer to a recorded intent: the
+// placed order, or the error it was rejected with.
+func (t *Trader) recordResult(r *store.OrderRecord, order *exchange.Order, err error) {
+	if r == nil {
+		return
+	}
+	if err != nil {
+		r.Status = exchange.StatusRejected
+		r.Error = err.Error()
+		r.UpdatedAt = t.clock.Now()
+		if err := t.db.UpdateOrder(r); err != nil {
+			fmt.Printf("[ORDERS] [%s] Failed to update order %d: %v\n", t.Symbol, r.ID, err)
+		}
+		return
+	}
+	t.saveOrder(r, order)
+}
+
+// trackOrder records a later view of a placed order, from a query or a
+// cancel. Orders placed before they were recorded are ignored.
+func (t *Trader) trackOrder(order *exchange.Order) {
+	r, err := t.db.FindOrder(t.Symbol, order.OrderID)
+	if err != nil {
+		return
+	}
+	if r.Status == order.Status && r.ExecutedQty == order.ExecutedQty {
+		return
+	}
+	t.saveOrder(r, order)
+}
+
+func (t *Trader) saveOrder(r *store.OrderRecord, order *exchange.Order) {
+	r.ClientOrderID = order.ClientOrderID
+	r.ExchangeOrderID = order.OrderID
+	r.OrderListID = order.OrderListID
+	r.Status = order.Status
+	if order.Price > 0 {
+		r.Price = order.Price
+	}
+	if order.StopPrice > 0 {
+		r.StopPrice = order.StopPrice
+	}
+	r.OrigQty = order.OrigQty
+	r.ExecutedQty = order.ExecutedQty
+	r.QuoteQty = order.QuoteQty
+	r.Fills = r.Fills[:0]
+	for _, f := range order.Fills {
+		r.Fills = append(r.Fills, store.OrderFill{
+			TradeID:         f.TradeID,
+			Price:           f.Price,
+			Qty:             f.Qty,
+			Commission:      f.Commission,
+			CommissionAsset: f.CommissionAsset,
+			CommissionQuote: t.fillFee(f),
+			Time:            order.Time,
+		})
+	}
+	r.UpdatedAt = t.clock.Now()
+	if err := t.db.UpdateOrder(r); err != nil {
+		fmt.Printf("[ORDERS] [%s] Failed to update order %d: %v\n", t.Symbol, r.ID, err)
+	}
+}
+
+// closePosition ends the current position in the store.
+func (t *Trader) closePosition(pnl float64) {
+	if t.positionID == 0 {
+		return
+	}
+	if err := t.db.ClosePosition(t.positionID, t.clock.Now(), pnl); err != nil {
+		fmt.Printf("[ORDERS] [%s] Failed to close position %d: %v\n", t.Symbol, t.positionID, err)
+	}
+	t.positionID = 0
+}
+
+// reportOrderError logs an order the exchange refused. Orders stopped by the
+// symbol's trading rules before they were sent are only logged; anything
+// else is also sent to the notifier.
+func (t *Trader) reportOrderError(action string, err error) {
+	var fe *exchange.FilterError
+	if errors.As(err, &fe) {
+		fmt.Printf("[FILTER] [%s] %s skipped: %v\n", t.Symbol, action, err)
+		return
+	}
+	t.notifier.Send(fmt.Sprintf("[ERROR] [%s] %s failed: %v", t.Symbol, action, err))
+}
+
+// Orders that fail, or end without a fill, are retried after orderRetryMin,
+// doubling with each further failure in a row up to orderRetryMax.
+const (
+	orderRetryMin = 15 * time.Second
+	orderRetryMax = 10 * time.Minute
+)
+
+// orderRetry tracks consecutive failed orders on one side.
+type orderRetry struct {
+	failures int
+	at       time.Time
+}
+
+// orderFailed reports a failed order and backs off the next attempt.
+func (t *Trader) orderFailed(r *orderRetry, action string, err error) {
+	t.reportOrderError(action, err)
+	r.failures++
+	wait := orderRetryMin
+	for i := 1; i < r.failures && wait < orderRetryMax; i++ {
+		wait *= 2
+	}
+	if wait > orderRetryMax {
+		wait = orderRetryMax
+	}
+	r.at = t.clock.Now().Add(wait)
+	fmt.Printf("[RETRY] [%s] %s failed %d time(s) in a row; retrying in %s\n", t.Symbol, action, r.failures, wait)
+}
+
+// retryPending reports whether orders on a side are still backing off.
+func (t *Trader) retryPending(r *orderRetry, side string) bool {
+	if r.failures == 0 || !t.clock.Now().Before(r.at) {
+		return false
+	}
+	fmt.Printf("[RETRY] [%s] Holding off %s for %.0fs after %d failed order(s)\n", t.Symbol, side, r.at.Sub(t.clock.Now()).Seconds(), r.failures)
+	return true
+}
+
+// unfilled returns an error for an accepted order that ended without a
+// fill, such as a market order EXPIRED for lack of liquidity or one the
+// matching engine REJECTED.
+func unfilled(order *exchange.Order) error {
+	if order.ExecutedQty > 0 {
+		return nil
+	}
+	return fmt.Errorf("order %d %s without a fill", order.OrderID, order.Status)
+}
+
+// quoteAmount is the quote asset an order executed, before commission.
+func quoteAmount(order *exchange.Order) float64 {
+	if order.QuoteQty > 0 {
+		return order.QuoteQty
+	}
+	return order.ExecutedQty * order.AvgPrice()
+}
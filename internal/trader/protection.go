@@ -0,0 +1,203 @@
+package trader
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"traderider/internal/exchange"
+)
+
+const (
+	// ProtectionNone leaves stops to the trading loop.
+	ProtectionNone = "none"
+	// ProtectionStop rests a stop-loss limit sell on the exchange.
+	ProtectionStop = "stop"
+	// ProtectionOCO rests a take-profit and a stop-loss limit sell as one OCO list.
+	ProtectionOCO = "oco"
+)
+
+// protectionRetry is how long to wait before placing protection again after
+// the exchange rejected it.
+const protectionRetry = time.Minute
+
+// protection is the set of exchange-side sell orders guarding the position.
+// Their quantity is locked on the exchange, so it is missing from the free
+// balance while they rest.
+type protection struct {
+	orderIDs  []int64
+	stopPrice float64
+	quantity  float64
+	high      float64 // highest price seen while protected
+}
+
+// protectiveStop is the stop for the current position: protectionStopLoss
+// below the average buy price, raised to the trailing stop below high once
+// that locks in the minimum profit.
+func (t *Trader) protectiveStop(high float64) float64 {
+	high = math.Max(high, t.trailingHigh)
+	stop := t.averageBuyPrice * (1 - t.protectionStopLoss)
+	np := t.se.NetProfit(high, t.averageBuyPrice)
+	trail := high * (1 - t.se.TrailingStop(np))
+	if t.se.NetProfit(trail, t.averageBuyPrice) >= t.se.MinProfitMargin {
+		stop = math.Max(stop, trail)
+	}
+	return stop
+}
+
+// protect places the protective orders for the position.
+func (t *Trader) protect(price float64) {
+	so, ok := t.ex.(exchange.StopOrderer)
+	if !ok || t.protectionMode == ProtectionNone || !t.holding || t.protection != nil {
+		return
+	}
+	if t.clock.Now().Before(t.protectRetryAt) {
+		return
+	}
+
+	filter := t.ex.GetSymbolFilter(t.Symbol)
+	quantity := filter.FloorQty(t.assetHeld, false)
+	stop := filter.FloorPrice(t.protectiveStop(price))
+	limit := stop * (1 - t.protectionLimitOffset)
+
+	var orders []*exchange.Order
+	var err error
+	if t.protectionMode == ProtectionOCO {
+		takeProfit := math.Max(t.averageBuyPrice*(1+t.protectionTakeProfit), price*(1+t.protectionUpdateStep))
+		tpRec := t.recordIntent(exchange.SideSell, exchange.OrderTypeLimitMaker, reasonProtection, quantity, takeProfit, 0)
+		slRec := t.recordIntent(exchange.SideSell, exchange.OrderTypeStopLoss, reasonProtection, quantity, limit, stop)
+		orders, err = so.PlaceOCO(t.Symbol, quantity, takeProfit, stop, limit)
+		if err != nil {
+			t.recordResult(tpRec, nil, err)
+			t.recordResult(slRec, nil, err)
+		}
+		for _, o := range orders {
+			if o.Type == exchange.OrderTypeStopLoss {
+				t.recordResult(slRec, o, nil)
+			} else {
+				t.recordResult(tpRec, o, nil)
+			}
+		}
+	} else {
+		rec := t.recordIntent(exchange.SideSell, exchange.OrderTypeStopLoss, reasonProtection, quantity, limit, stop)
+		var order *exchange.Order
+		order, err = so.StopLossLimit(t.Symbol, quantity, stop, limit)
+		t.recordResult(rec, order, err)
+		orders = []*exchange.Order{order}
+	}
+	if err != nil {
+		t.protectRetryAt = t.clock.Now().Add(protectionRetry)
+		msg := fmt.Sprintf("[PROTECT] [%s] Failed to place %s protection: %v", t.Symbol, t.protectionMode, err)
+		fmt.Println(msg)
+		t.notifier.Send(msg)
+		return
+	}
+
+	p := &protection{stopPrice: stop, quantity: quantity, high: price}
+	for _, o := range orders {
+		p.orderIDs = append(p.orderIDs, o.OrderID)
+	}
+	t.protection = p
+	fmt.Printf("[PROTECT] [%s] %s protection for %.6f with stop %.4f (orders %v)\n", t.Symbol, t.protectionMode, quantity, stop, p.orderIDs)
+	// The orders are placed after the trade was saved; a restart must
+	// still find them.
+	if err := t.saveState(); err != nil {
+		msg := fmt.Sprintf("[STATE] [%s] Failed to save protective orders %v: %v", t.Symbol, p.orderIDs, err)
+		fmt.Println(msg)
+		t.notifier.Send(msg)
+	}
+}
+
+// checkProtection follows the protective orders while holding: an executed
+// leg closes the position, and the orders are replaced once the protective
+// stop has risen by more than protectionUpdateStep. It reports whether the
+// position was closed.
+func (t *Trader) checkProtection(price float64) bool {
+	if t.protection == nil {
+		t.protect(price)
+		return false
+	}
+
+	// All legs are queried before acting so the store sees the sibling of
+	// an executed leg expire too.
+	so := t.ex.(exchange.StopOrderer)
+	open := false
+	var executed *exchange.Order
+	for _, id := range t.protection.orderIDs {
+		order, err := so.GetOrder(t.Symbol, id)
+		if err != nil {
+			fmt.Printf("[PROTECT] [%s] Failed to query order %d: %v\n", t.Symbol, id, err)
+			return false
+		}
+		t.trackOrder(order)
+		if order.IsOpen() {
+			open = true
+		} else if order.ExecutedQty > 0 {
+			executed = order
+		}
+	}
+	if executed != nil {
+		t.protection = nil
+		t.recordProtectedSell(executed)
+		return true
+	}
+	if !open {
+		// Cancelled or expired outside the bot; place them again.
+		fmt.Printf("[PROTECT] [%s] Protective orders closed without a fill\n", t.Symbol)
+		t.protection = nil
+		t.protect(price)
+		return false
+	}
+
+	t.protection.high = math.Max(t.protection.high, price)
+	if t.protectiveStop(t.protection.high) > t.protection.stopPrice*(1+t.protectionUpdateStep) {
+		closed, err := t.unprotect()
+		if closed || err != nil {
+			return closed
+		}
+		t.protect(price)
+	}
+	return false
+}
+
+// unprotect cancels the protective orders so the position can be sold or
+// added to. If a leg executed first, the sell is booked and closed is true.
+// An error means the orders may still rest and hold the position's balance.
+func (t *Trader) unprotect() (closed bool, err error) {
+	if t.protection == nil {
+		return false, nil
+	}
+
+	so := t.ex.(exchange.StopOrderer)
+	var executed *exchange.Order
+	for _, id := range t.protection.orderIDs {
+		// Cancelling one leg of an OCO list cancels the others, so a
+		// failed cancel is confirmed by querying the order.
+		order, err := so.CancelOrder(t.Symbol, id)
+		if err != nil {
+			if order, err = so.GetOrder(t.Symbol, id); err != nil {
+				return false, fmt.Errorf("cancel protective order %d: %w", id, err)
+			}
+			if order.IsOpen() {
+				return false, fmt.Errorf("protective order %d is still %s", id, order.Status)
+			}
+		}
+		t.trackOrder(order)
+		if order.ExecutedQty > 0 {
+			executed = order
+		}
+	}
+	t.protection = nil
+	if executed != nil {
+		t.recordProtectedSell(executed)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (t *Trader) recordProtectedSell(order *exchange.Order) {
+	netProfit := t.recordSell(order)
+	msg := fmt.Sprintf("[PROTECT] [%s] Protective %s sell filled at %.4f | NetProfit: %.2f%%", t.Symbol, order.Type, order.AvgPrice(), netProfit*100)
+	fmt.Println(msg)
+	t.notifier.Send(msg)
+}
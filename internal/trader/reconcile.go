@@ -0,0 +1,329 @@
+package trader
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"traderider/internal/exchange"
+	"traderider/internal/store"
+)
+
+// Reconciliation is the outcome of checking a trader's saved state against
+// its trade history and the exchange at startup. A symbol with issues is not
+// traded until they are resolved and it is reconciled again, or the issues
+// are acknowledged.
+type Reconciliation struct {
+	Symbol    string    `json:"symbol"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// ExchangeQty is the free balance plus what the bot's protective orders lock.
+	ExchangeQty     float64  `json:"exchangeQty"`
+	HistoryQty      float64  `json:"historyQty"`
+	SavedQty        float64  `json:"savedQty"`
+	AverageBuyPrice float64  `json:"averageBuyPrice"` // rebuilt from trade history
+	Issues          []string `json:"issues,omitempty"`
+	Notes           []string `json:"notes,omitempty"`
+	Acknowledged    bool     `json:"acknowledged"`
+
+	basis costBasis
+}
+
+// Consistent reports whether the check found nothing that blocks trading.
+func (r *Reconciliation) Consistent() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *Reconciliation) issue(format string, args ...interface{}) {
+	r.Issues = append(r.Issues, fmt.Sprintf(format, args...))
+}
+
+func (r *Reconciliation) note(format string, args ...interface{}) {
+	r.Notes = append(r.Notes, fmt.Sprintf(format, args...))
+}
+
+// costBasis is the open position rebuilt from the recorded trades.
+type costBasis struct {
+	qty      float64
+	cost     float64
+	entries  int
+	firstBuy time.Time
+}
+
+func (b costBasis) averagePrice() float64 {
+	if b.qty <= 0 {
+		return 0
+	}
+	return b.cost / b.qty
+}
+
+// rebuildCostBasis replays trades oldest first, counting buy fees as cost;
+// trades recorded without a fee are assumed to have paid commissionRate. A
+// sell of less than the held quantity reduces the cost pro rata; anything
+// more closes the position.
+func rebuildCostBasis(txs []store.Transaction, commissionRate float64) costBasis {
+	var b costBasis
+	for _, tx := range txs {
+		switch tx.Side {
+		case "BUY":
+			if b.qty <= 0 {
+				b = costBasis{firstBuy: tx.Time}
+			}
+			fee := tx.Fee
+			if !tx.FeeRecorded {
+				fee = tx.Amount * tx.Price * commissionRate
+			}
+			b.qty += tx.Amount
+			b.cost += tx.Amount*tx.Price + fee
+			b.entries++
+		case "SELL":
+			if tx.Amount >= b.qty*0.999 {
+				b = costBasis{}
+				continue
+			}
+			b.cost *= (b.qty - tx.Amount) / b.qty
+			b.qty -= tx.Amount
+		}
+	}
+	return b
+}
+
+// Reconcile restores saved (which may be nil) and checks it against the
+// recorded orders and trades and the exchange's balances and open orders.
+// Trades a protective order made while the bot was down are booked, and the
+// position is rebuilt from the trade history. If issues remain, Tick does
+// nothing until they are acknowledged. It is called before Run is started;
+// use ReconcileAgain afterwards.
+func (t *Trader) Reconcile(saved *StateSnapshot) *Reconciliation {
+	r := &Reconciliation{Symbol: t.Symbol, CheckedAt: t.clock.Now()}
+	if saved != nil {
+		t.RestoreState(*saved)
+		r.SavedQty = saved.AssetHeld
+	}
+
+	t.reconcileProtection(r)
+	known := make(map[int64]bool)
+	if t.protection != nil {
+		for _, id := range t.protection.orderIDs {
+			known[id] = true
+		}
+	}
+	t.reconcileRecordedOrders(r, known)
+
+	// Open orders the bot did not place, or no longer follows, keep their
+	// quantity locked; only free balance and protection count as held.
+	if lister, ok := t.ex.(exchange.OpenOrderLister); ok {
+		open, err := lister.GetOpenOrders(t.Symbol)
+		if err != nil {
+			r.issue("cannot list open orders: %v", err)
+		}
+		for _, o := range open {
+			if known[o.OrderID] {
+				continue
+			}
+			if _, err := t.db.FindOrder(t.Symbol, o.OrderID); err != nil {
+				r.issue("unknown open %s %s order %d for %.6f on the exchange", o.Type, o.Side, o.OrderID, o.OrigQty-o.ExecutedQty)
+			}
+		}
+	} else {
+		r.note("exchange cannot list open orders; not checked")
+	}
+
+	free, err := t.ex.GetAssetBalance(t.baseAsset())
+	if err != nil {
+		r.issue("cannot read %s balance: %v", t.baseAsset(), err)
+	}
+	r.ExchangeQty = free
+	if t.protection != nil {
+		r.ExchangeQty += t.protection.quantity
+	}
+
+	txs, err := t.db.GetAllTransactions(t.Symbol)
+	if err != nil {
+		r.issue("cannot read trade history: %v", err)
+	}
+	r.basis = rebuildCostBasis(txs, t.se.CommissionRate)
+	r.HistoryQty = r.basis.qty
+	r.AverageBuyPrice = r.basis.averagePrice()
+
+	dust := t.dust()
+	if math.Abs(r.ExchangeQty-r.HistoryQty) > dust {
+		r.issue("exchange holds %.6f %s but trade history adds up to %.6f", r.ExchangeQty, t.baseAsset(), r.HistoryQty)
+	}
+	if saved != nil && math.Abs(saved.AssetHeld-r.HistoryQty) > dust {
+		r.note("saved state held %.6f; using trade history", saved.AssetHeld)
+	}
+	if saved != nil && saved.AverageBuyPrice > 0 && r.AverageBuyPrice > 0 &&
+		math.Abs(saved.AverageBuyPrice-r.AverageBuyPrice)/r.AverageBuyPrice > 0.001 {
+		r.note("saved average buy price %.4f differs from trade history %.4f; using trade history", saved.AverageBuyPrice, r.AverageBuyPrice)
+	}
+
+	t.reconciliation = r
+	t.blockLogged = false
+	if r.Consistent() {
+		t.applyReconciliation(r)
+	}
+	for _, n := range r.Notes {
+		fmt.Printf("[RECONCILE] [%s] %s\n", t.Symbol, n)
+	}
+	for _, i := range r.Issues {
+		fmt.Printf("[RECONCILE] [%s] ISSUE: %s\n", t.Symbol, i)
+	}
+	return r
+}
+
+// reconcileProtection books a protective order that executed while the bot
+// was down and forgets protection that is no longer resting.
+func (t *Trader) reconcileProtection(r *Reconciliation) {
+	if t.protection == nil {
+		return
+	}
+	so, ok := t.ex.(exchange.StopOrderer)
+	if !ok {
+		r.note("saved protective orders %v cannot be checked on this exchange", t.protection.orderIDs)
+		t.protection = nil
+		return
+	}
+
+	open := false
+	var executed *exchange.Order
+	for _, id := range t.protection.orderIDs {
+		order, err := so.GetOrder(t.Symbol, id)
+		if err != nil {
+			r.issue("cannot query protective order %d: %v", id, err)
+			return
+		}
+		t.trackOrder(order)
+		if order.IsOpen() {
+			open = true
+		} else if order.ExecutedQty > 0 {
+			executed = order
+		}
+	}
+	switch {
+	case executed != nil:
+		t.protection = nil
+		t.recordProtectedSell(executed)
+		r.note("protective order %d executed while stopped; sell booked", executed.OrderID)
+	case !open:
+		t.protection = nil
+		r.note("saved protective orders are no longer open")
+	}
+}
+
+// reconcileRecordedOrders refreshes orders the store last saw pending or
+// open. Any that are still open, executed unbooked, or never reached the
+// exchange are reported.
+func (t *Trader) reconcileRecordedOrders(r *Reconciliation, known map[int64]bool) {
+	records, err := t.db.GetUnsettledOrders(t.Symbol)
+	if err != nil {
+		r.issue("cannot read recorded orders: %v", err)
+		return
+	}
+	lo, _ := t.ex.(exchange.LimitOrderer)
+	for _, rec := range records {
+		if known[rec.ExchangeOrderID] {
+			continue
+		}
+		if rec.Status == store.OrderPending {
+			r.issue("order %d (%s %s) was recorded but its outcome is unknown", rec.ID, rec.Type, rec.Side)
+			continue
+		}
+		if lo == nil {
+			r.issue("order %d was %s and cannot be checked on this exchange", rec.ID, rec.Status)
+			continue
+		}
+		order, err := lo.GetOrder(t.Symbol, rec.ExchangeOrderID)
+		if err != nil {
+			r.issue("cannot query order %d: %v", rec.ID, err)
+			continue
+		}
+		t.trackOrder(order)
+		known[order.OrderID] = true
+		switch {
+		case order.IsOpen():
+			r.issue("%s %s order %d from a previous run is still open", order.Type, order.Side, order.OrderID)
+		case order.ExecutedQty > 0:
+			r.issue("%s %s order %d executed %.6f while stopped", order.Type, order.Side, order.OrderID, order.ExecutedQty)
+		}
+	}
+}
+
+// dust is the largest quantity difference treated as equal: one lot step,
+// or whatever is too small to trade.
+func (t *Trader) dust() float64 {
+	filter := t.ex.GetSymbolFilter(t.Symbol)
+	dust := filter.StepSize
+	if price := t.ex.GetSymbolPrice(t.Symbol); price > 0 {
+		dust = math.Max(dust, filter.MinNotional/price)
+	}
+	return dust
+}
+
+// applyReconciliation takes the exchange quantity as the position, valued at
+// the rebuilt average buy price.
+func (t *Trader) applyReconciliation(r *Reconciliation) {
+	if r.ExchangeQty <= t.dust() {
+		t.resetState()
+		return
+	}
+	avg := r.AverageBuyPrice
+	if avg == 0 {
+		avg = t.averageBuyPrice
+	}
+	if avg == 0 {
+		avg = t.ex.GetSymbolPrice(t.Symbol)
+		r.note("no cost basis; valuing %.6f at the current price %.4f", r.ExchangeQty, avg)
+	}
+	t.assetHeld = r.ExchangeQty
+	t.averageBuyPrice = avg
+	t.usdcInvested = r.ExchangeQty * avg
+	t.holding = true
+	t.trailingHigh = math.Max(t.trailingHigh, avg)
+	if r.basis.entries > 0 {
+		t.entries = r.basis.entries
+		t.se.LastBuyTime = r.basis.firstBuy
+	}
+}
+
+func (t *Trader) acknowledge() error {
+	r := t.reconciliation
+	if r == nil {
+		return fmt.Errorf("%s has not been reconciled", t.Symbol)
+	}
+	records, err := t.db.GetUnsettledOrders(t.Symbol)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if rec.Status == store.OrderPending {
+			rec.Status = store.OrderUnknown
+			rec.UpdatedAt = t.clock.Now()
+			if err := t.db.UpdateOrder(&rec); err != nil {
+				return err
+			}
+		}
+	}
+	if !r.Acknowledged {
+		r.Acknowledged = true
+		t.applyReconciliation(r)
+	}
+	fmt.Printf("[RECONCILE] [%s] Issues acknowledged; holding %.6f at %.4f\n", t.Symbol, t.assetHeld, t.averageBuyPrice)
+	return nil
+}
+
+// copy returns a copy of r that does not share its issues and notes.
+func (r *Reconciliation) copy() *Reconciliation {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Issues = append([]string(nil), r.Issues...)
+	c.Notes = append([]string(nil), r.Notes...)
+	return &c
+}
+
+// blocked reports whether unresolved reconciliation issues stop trading.
+func (t *Trader) blocked() bool {
+	r := t.reconciliation
+	return r != nil && !r.Consistent() && !r.Acknowledged
+}
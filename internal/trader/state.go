@@ -0,0 +1,161 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"traderider/internal/store"
+	"traderider/internal/strategy"
+)
+
+// StateVersion is the layout of StateSnapshot as saved in the store.
+// Version 1 is the unversioned data/state.json of earlier releases; version
+// 2 has no Mode, so its traders restore as active.
+const StateVersion = 3
+
+// StateSnapshot is everything a trader needs to carry on after a restart.
+type StateSnapshot struct {
+	AssetHeld       float64
+	USDCInvested    float64
+	USDCProfit      float64
+	AverageBuyPrice float64
+	TrailingHigh    float64
+	Entries         int
+	Holding         bool
+	LastSellPrice   float64
+	LastSellTime    time.Time
+	LastSellProfit  float64
+	// InvestmentPerTrade is the allocation last set by rebalancing.
+	InvestmentPerTrade float64
+	Strategy           strategy.State
+	// Protective orders resting on the exchange, if any.
+	ProtectionOrderIDs []int64
+	ProtectionStop     float64
+	ProtectionQty      float64
+	PositionID         int64
+	Mode               string
+}
+
+func (t *Trader) snapshotState() StateSnapshot {
+	s := StateSnapshot{
+		AssetHeld:          t.assetHeld,
+		USDCInvested:       t.usdcInvested,
+		USDCProfit:         t.usdcProfit,
+		AverageBuyPrice:    t.averageBuyPrice,
+		TrailingHigh:       t.trailingHigh,
+		Entries:            t.entries,
+		Holding:            t.holding,
+		LastSellPrice:      t.lastSellPrice,
+		LastSellTime:       t.lastSellTime,
+		LastSellProfit:     t.lastSellProfit,
+		InvestmentPerTrade: t.investmentPerTrade,
+		Strategy:           t.se.State(),
+		PositionID:         t.positionID,
+		Mode:               t.mode,
+	}
+	if t.protection != nil {
+		s.ProtectionOrderIDs = t.protection.orderIDs
+		s.ProtectionStop = t.protection.stopPrice
+		s.ProtectionQty = t.protection.quantity
+	}
+	return s
+}
+
+func (t *Trader) RestoreState(s StateSnapshot) {
+	t.assetHeld = s.AssetHeld
+	t.usdcInvested = s.USDCInvested
+	t.usdcProfit = s.USDCProfit
+	t.averageBuyPrice = s.AverageBuyPrice
+	t.trailingHigh = s.TrailingHigh
+	t.entries = s.Entries
+	t.holding = s.Holding
+	t.lastSellPrice = s.LastSellPrice
+	t.lastSellTime = s.LastSellTime
+	t.lastSellProfit = s.LastSellProfit
+	if s.InvestmentPerTrade > 0 {
+		t.investmentPerTrade = s.InvestmentPerTrade
+	}
+	t.se.Restore(s.Strategy)
+	t.positionID = s.PositionID
+	t.mode = ModeActive
+	if s.Mode != "" {
+		t.mode = s.Mode
+	}
+	t.protection = nil
+	if len(s.ProtectionOrderIDs) > 0 {
+		t.protection = &protection{orderIDs: s.ProtectionOrderIDs, stopPrice: s.ProtectionStop, quantity: s.ProtectionQty}
+	}
+}
+
+// encodeState prepares the current state for the store.
+func (t *Trader) encodeState() (store.TraderState, error) {
+	data, err := json.Marshal(t.snapshotState())
+	if err != nil {
+		return store.TraderState{}, err
+	}
+	return store.TraderState{Symbol: t.Symbol, Version: StateVersion, Data: data, UpdatedAt: t.clock.Now()}, nil
+}
+
+// SaveState writes the trader's state to the store.
+func (t *Trader) SaveState() error {
+	var err error
+	t.view(func() { err = t.saveState() })
+	return err
+}
+
+func (t *Trader) saveState() error {
+	st, err := t.encodeState()
+	if err != nil {
+		return err
+	}
+	return t.db.SaveState(st)
+}
+
+// logTrade records a trade together with the state it left the trader in.
+// Failures are reported loudly: the trade happened on the exchange even if
+// it could not be recorded.
+func (t *Trader) logTrade(side string, amount, price, fee float64) {
+	st, err := t.encodeState()
+	if err == nil {
+		err = t.db.LogTradeWithState(t.Symbol, side, amount, price, fee, t.clock.Now(), st)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("[STATE] [%s] Failed to record %s of %.6f at %.4f: %v", t.Symbol, side, amount, price, err)
+		fmt.Println(msg)
+		t.notifier.Send(msg)
+	}
+}
+
+// DecodeState reads a saved state, refusing layouts newer than StateVersion
+// and data that does not parse.
+func DecodeState(st store.TraderState) (StateSnapshot, error) {
+	var s StateSnapshot
+	if st.Version > StateVersion {
+		return s, fmt.Errorf("state of %s has version %d, newer than the supported %d", st.Symbol, st.Version, StateVersion)
+	}
+	if err := json.Unmarshal(st.Data, &s); err != nil {
+		return s, fmt.Errorf("state of %s is corrupt: %w", st.Symbol, err)
+	}
+	if s.Mode != "" && !validMode(s.Mode) {
+		return s, fmt.Errorf("state of %s has unknown mode %q", st.Symbol, s.Mode)
+	}
+	return s, nil
+}
+
+// LoadStates decodes the saved state of every symbol in the store.
+func LoadStates(db *store.Store) (map[string]StateSnapshot, error) {
+	saved, err := db.LoadStates()
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]StateSnapshot, len(saved))
+	for symbol, st := range saved {
+		s, err := DecodeState(st)
+		if err != nil {
+			return nil, err
+		}
+		states[symbol] = s
+	}
+	return states, nil
+}
@@ -2,11 +2,13 @@ package trader
 
 import (
 	"fmt"
-	"math"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"traderider/internal/binance"
+	"traderider/internal/clock"
+	"traderider/internal/exchange"
 	"traderider/internal/market"
 	"traderider/internal/notifier"
 	"traderider/internal/store"
@@ -14,194 +16,330 @@ import (
 	"traderider/internal/wallet"
 )
 
+// Trader trades one symbol. Until Run is started its methods may be called
+// directly; after that its state belongs to the Run goroutine and other
+// goroutines go through the command methods in loop.go.
 type Trader struct {
-	Symbol              string
-	db                  *store.Store
-	mw                  *market.MarketWatcher
-	se                  *strategy.StrategyEngine
-	binClient           *binance.Client
-	wallet              *wallet.WalletManager
-	demo                bool
-	assetHeld           float64
-	usdcInvested        float64
-	usdcProfit          float64
-	dailyStartValue     float64
-	investmentPerTrade  float64
-	holding             bool
-	averageBuyPrice     float64
-	trailingHigh        float64
-	trailingStopPct     float64
-	entries             int
-	maxEntries          int
-	lastSellTime        time.Time
-	cooldownDuration    time.Duration
-	minSellInterval     time.Duration
-	lastSellPrice       float64
-	lastSellProfit      float64
-	minHoldingThreshold float64
-	minHoldDuration     time.Duration
-	stopCh              chan struct{}
-	notifier            *notifier.WhatsAppNotifier
+	Symbol string
+	// Timeframe selects the indicator input: "" for one-second samples, or a
+	// candle interval such as "1m" or "5m".
+	Timeframe             string
+	db                    *store.Store
+	mw                    *market.MarketWatcher
+	se                    *strategy.StrategyEngine
+	strategy              strategy.Strategy
+	ex                    exchange.Exchange
+	wallet                *wallet.WalletManager
+	assetHeld             float64
+	usdcInvested          float64
+	usdcProfit            float64
+	dailyStartValue       float64
+	investmentPerTrade    float64
+	reserved              float64 // quote amount set aside in the wallet for the current buy
+	holding               bool
+	averageBuyPrice       float64
+	trailingHigh          float64
+	entries               int
+	maxEntries            int
+	lastSellTime          time.Time
+	cooldownDuration      time.Duration
+	minSellInterval       time.Duration
+	lastSellPrice         float64
+	lastSellProfit        float64
+	minHoldingThreshold   float64
+	minHoldDuration       time.Duration
+	entryMode             string
+	makerTimeout          time.Duration
+	makerMaxReprices      int
+	makerFallbackMarket   bool
+	entry                 *pendingEntry
+	protectionMode        string
+	protectionStopLoss    float64
+	protectionTakeProfit  float64
+	protectionLimitOffset float64
+	protectionUpdateStep  float64
+	protection            *protection
+	protectRetryAt        time.Time
+	positionID            int64 // store position the current orders belong to
+	buyRetry              orderRetry
+	sellRetry             orderRetry
+	feeRates              map[string]float64 // commission asset rates for this tick
+	reconciliation        *Reconciliation
+	blockLogged           bool // the current block has been logged
+	mode                  string
+	cmds                  chan func(stopping bool)
+	done                  chan struct{} // closed when Run returns
+	startMu               sync.Mutex    // held by commands run before Run starts
+	started               bool
+	draining              atomic.Bool
+	notifier              *notifier.WhatsAppNotifier
+	clock                 clock.Clock
 }
 
-func NewTrader(db *store.Store, mw *market.MarketWatcher, se *strategy.StrategyEngine, demo bool, investmentPerTrade float64, binClient *binance.Client, minHoldingThreshold float64, minHoldDuration time.Duration, wallet *wallet.WalletManager, stopCh chan struct{}, notifier *notifier.WhatsAppNotifier) *Trader {
+// Config holds the per-symbol position sizing and timing rules.
+type Config struct {
+	InvestmentPerTrade  float64
+	MinHoldingThreshold float64
+	MinHoldDuration     time.Duration
+	// MinSellInterval is the shortest time after the first buy before selling.
+	MinSellInterval time.Duration
+	MaxEntries      int // defaults to 3
+	Cooldown        time.Duration
+	// EntryMode is EntryMarket (default) or EntryMaker.
+	EntryMode           string
+	MakerTimeout        time.Duration // defaults to 30s
+	MakerMaxReprices    int
+	MakerFallbackMarket bool
+	// Protection is ProtectionNone (default), ProtectionStop or ProtectionOCO.
+	Protection            string
+	ProtectionStopLoss    float64 // defaults to 5%
+	ProtectionTakeProfit  float64 // defaults to 5%
+	ProtectionLimitOffset float64
+	ProtectionUpdateStep  float64
+}
+
+func NewTrader(db *store.Store, mw *market.MarketWatcher, se *strategy.StrategyEngine, cfg Config, ex exchange.Exchange, wallet *wallet.WalletManager, notifier *notifier.WhatsAppNotifier) *Trader {
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = 3
+	}
+	if cfg.EntryMode == "" {
+		cfg.EntryMode = EntryMarket
+	}
+	if cfg.MakerTimeout == 0 {
+		cfg.MakerTimeout = 30 * time.Second
+	}
+	if cfg.Protection == "" {
+		cfg.Protection = ProtectionNone
+	}
+	if cfg.ProtectionStopLoss == 0 {
+		cfg.ProtectionStopLoss = 0.05
+	}
+	if cfg.ProtectionTakeProfit == 0 {
+		cfg.ProtectionTakeProfit = 0.05
+	}
+	defaultStrategy, _ := strategy.New(strategy.Default, se)
 	return &Trader{
-		db:                  db,
-		mw:                  mw,
-		se:                  se,
-		binClient:           binClient,
-		wallet:              wallet,
-		demo:                demo,
-		investmentPerTrade:  investmentPerTrade,
-		holding:             false,
-		trailingStopPct:     0.02,
-		maxEntries:          3,
-		cooldownDuration:    90 * time.Second,
-		minSellInterval:     12 * time.Minute,
-		minHoldingThreshold: minHoldingThreshold,
-		minHoldDuration:     minHoldDuration,
-		stopCh:              stopCh,
-		notifier:            notifier,
+		db:                    db,
+		mw:                    mw,
+		se:                    se,
+		strategy:              defaultStrategy,
+		ex:                    ex,
+		wallet:                wallet,
+		investmentPerTrade:    cfg.InvestmentPerTrade,
+		holding:               false,
+		maxEntries:            cfg.MaxEntries,
+		cooldownDuration:      cfg.Cooldown,
+		minSellInterval:       cfg.MinSellInterval,
+		minHoldingThreshold:   cfg.MinHoldingThreshold,
+		minHoldDuration:       cfg.MinHoldDuration,
+		entryMode:             cfg.EntryMode,
+		makerTimeout:          cfg.MakerTimeout,
+		makerMaxReprices:      cfg.MakerMaxReprices,
+		makerFallbackMarket:   cfg.MakerFallbackMarket,
+		protectionMode:        cfg.Protection,
+		protectionStopLoss:    cfg.ProtectionStopLoss,
+		protectionTakeProfit:  cfg.ProtectionTakeProfit,
+		protectionLimitOffset: cfg.ProtectionLimitOffset,
+		protectionUpdateStep:  cfg.ProtectionUpdateStep,
+		mode:                  ModeActive,
+		cmds:                  make(chan func(stopping bool)),
+		done:                  make(chan struct{}),
+		notifier:              notifier,
+		clock:                 clock.Real{},
 	}
 }
 
-func (t *Trader) Run() {
-	for {
-		select {
-		case <-t.stopCh:
-			fmt.Printf("[STOPPED] Trader for %s stopped by hard stop\n", t.Symbol)
-			return
-		default:
+// Tick runs a single evaluation of the trading loop. Run calls it every
+// tickInterval; the backtester calls it directly on simulated time.
+func (t *Trader) Tick() {
+	t.feeRates = nil
+	t.updateBalances()
+	if t.dailyStartValue == 0 {
+		return
+	}
+	if t.blocked() {
+		if !t.blockLogged {
+			fmt.Printf("[BLOCKED] [%s] Unresolved reconciliation issues; acknowledge via POST /api/reconcile/%s/ack\n", t.Symbol, t.Symbol)
+			t.blockLogged = true
 		}
+		return
+	}
+	t.blockLogged = false
 
-		time.Sleep(5 * time.Second)
-		t.updateBalances()
-		if t.dailyStartValue == 0 {
-			continue
-		}
+	if t.entry != nil {
+		t.checkEntry()
+		return
+	}
 
-		price := t.mw.GetPrice(t.Symbol)
-		history := t.mw.GetHistory(t.Symbol)
+	price := t.mw.GetPrice(t.Symbol)
+	history := t.mw.GetSeries(t.Symbol, t.Timeframe)
 
-		t.resetIfInvalid(price)
+	t.resetIfInvalid(price)
 
-		if t.inCooldown() {
-			continue
-		}
+	if t.holding && t.protectionMode != ProtectionNone && t.checkProtection(price) {
+		return
+	}
 
-		if t.canBuy(price, history) {
+	if t.inCooldown() {
+		return
+	}
+
+	canSell := t.canSell(price)
+	decision := t.strategy.Decide(strategy.Input{
+		Symbol:  t.Symbol,
+		Price:   price,
+		Spread:  t.mw.GetSpread(t.Symbol),
+		History: history,
+		Position: strategy.Position{
+			Holding:         t.holding,
+			Entries:         t.entries,
+			MaxEntries:      t.maxEntries,
+			AverageBuyPrice: t.averageBuyPrice,
+			TrailingHigh:    t.trailingHigh,
+			LastSellPrice:   t.lastSellPrice,
+			HoldingTime:     t.since(t.se.LastBuyTime),
+			CanSell:         canSell,
+		},
+	})
+
+	switch decision.Action {
+	case strategy.Buy:
+		if t.mode == ModeNoEntries {
+			fmt.Printf("[PAUSED] [%s] Buy signal ignored; new entries are paused\n", t.Symbol)
+			return
+		}
+		if t.retryPending(&t.buyRetry, "buy") {
+			return
+		}
+		// Protection is re-placed for the whole position once the buy is booked.
+		if closed, err := t.unprotect(); closed || err != nil {
+			if err != nil {
+				fmt.Printf("[PROTECT] [%s] %v\n", t.Symbol, err)
+			}
+			return
+		}
+		if t.wallet.Reserve(t.quoteAsset(), t.investmentPerTrade) {
+			t.reserved = t.investmentPerTrade
 			t.tryBuy(price)
-		} else if t.canSell(price, history) {
-			t.trySell(price)
 		}
+	case strategy.Sell:
+		if t.retryPending(&t.sellRetry, "sell") {
+			return
+		}
+		t.trySell(price)
+	default:
+		fmt.Printf("[HOLD] [%s] %s\n", t.Symbol, strings.Join(decision.Reasons, "; "))
 	}
 }
 
-func (t *Trader) inCooldown() bool {
-	if time.Since(t.lastSellTime) < t.cooldownDuration || t.lastSellProfit < -0.3 {
-		fmt.Printf("[COOLDOWN] [%s] %.0fs remaining\n", t.Symbol, (t.cooldownDuration - time.Since(t.lastSellTime)).Seconds())
-		return true
-	}
-	return false
+// SetStrategy replaces the default strategy.
+func (t *Trader) SetStrategy(s strategy.Strategy) {
+	t.strategy = s
 }
 
-func (t *Trader) canBuy(price float64, history []float64) bool {
-	if !t.wallet.Reserve(t.investmentPerTrade) {
-		return false
-	}
-
-	if t.holding && (t.entries >= t.maxEntries || price > t.averageBuyPrice*0.96) {
-		t.wallet.Release(t.investmentPerTrade)
-		return false
-	}
-
-	// Așteaptă o scădere semnificativă după SELL
-	if !t.holding && t.lastSellPrice > 0 && price > t.lastSellPrice*(1-0.005) {
-		t.wallet.Release(t.investmentPerTrade)
-		fmt.Printf("[WAIT] [%s] Waiting for price to drop after last SELL (%.2f → %.2f)\n", t.Symbol, t.lastSellPrice, price)
-		return false
-	}
-
-	// Confirmă formarea unui bottom local
-	/*if !confirmBottomFormation(history) {
-		t.wallet.Release(t.investmentPerTrade)
-		fmt.Printf("[SKIP] [%s] No bottom pattern detected\n", t.Symbol)
-		return false
-	}*/
-
-	// Bollinger Bands: cumpără doar în zona inferioară
-	if t.se.UseBollinger {
-		lower, _, _ := strategy.CalculateBollingerBands(history, t.se.BollingerWindow)
-		if price > lower*1.02 {
-			t.wallet.Release(t.investmentPerTrade)
-			fmt.Printf("[SKIP] [%s] Price not low enough in Bollinger band (%.2f > %.2f)\n", t.Symbol, price, lower*1.02)
-			return false
-		}
-	}
+// SetClock replaces the wall clock, e.g. with a simulated one for backtests.
+func (t *Trader) SetClock(c clock.Clock) {
+	t.clock = c
+	t.se.Clock = c
+}
 
-	// RSI: trebuie să fie destul de jos
-	rsi := t.se.CalculateRSI(history)
-	if rsi > 40 {
-		t.wallet.Release(t.investmentPerTrade)
-		fmt.Printf("[SKIP] [%s] RSI too high for buy: %.2f\n", t.Symbol, rsi)
-		return false
-	}
+func (t *Trader) since(ts time.Time) time.Duration {
+	return t.clock.Now().Sub(ts)
+}
 
-	// Spread verificare
-	spread := t.binClient.GetSpread(t.Symbol)
-	if spread > 0.002 {
-		t.wallet.Release(t.investmentPerTrade)
-		fmt.Printf("[SKIP] [%s] Spread too high: %.4f\n", t.Symbol, spread)
-		return false
+func (t *Trader) inCooldown() bool {
+	if t.since(t.lastSellTime) < t.cooldownDuration || t.lastSellProfit < -0.3 {
+		fmt.Printf("[COOLDOWN] [%s] %.0fs remaining\n", t.Symbol, (t.cooldownDuration - t.since(t.lastSellTime)).Seconds())
+		return true
 	}
+	return false
+}
 
-	return true
+// settleReserved ends the current reservation after a buy that spent
+// spent of it: the rest goes back to the wallet, and an overspend, e.g.
+// from slippage, is taken from it.
+func (t *Trader) settleReserved(spent float64) {
+	t.wallet.Release(t.quoteAsset(), t.reserved-spent)
+	t.reserved = 0
 }
 
 func (t *Trader) tryBuy(price float64) {
-	amount, err := t.binClient.CalculateBuyQty(t.Symbol, t.investmentPerTrade)
+	amount, err := t.ex.CalculateBuyQty(t.Symbol, t.reserved)
 	if err != nil || amount <= 0 {
-		t.wallet.Release(t.investmentPerTrade)
+		t.settleReserved(0)
 		//t.notifier.Send(fmt.Sprintf("[BUY ERROR] [%s] CalculateBuyQty failed: %v", t.Symbol, err))
 		return
 	}
 
-	executedPrice := price
-	if !t.demo {
-		executedPrice, err = t.binClient.MarketBuy(t.Symbol, amount)
-		if err != nil {
-			t.wallet.Release(t.investmentPerTrade)
-			t.notifier.Send(fmt.Sprintf("[ERROR] [%s] MarketBuy failed: %v", t.Symbol, err))
+	if t.entryMode == EntryMaker {
+		if lo, ok := t.ex.(exchange.LimitOrderer); ok {
+			t.placeEntry(lo, amount, 0)
 			return
 		}
 	}
+	t.marketBuy(amount)
+}
+
+func (t *Trader) marketBuy(amount float64) {
+	rec := t.recordIntent(exchange.SideBuy, exchange.OrderTypeMarket, t.buyReason(), amount, 0, 0)
+	order, err := t.ex.MarketBuy(t.Symbol, amount)
+	t.recordResult(rec, order, err)
+	if err == nil {
+		err = unfilled(order)
+	}
+	if err != nil {
+		t.settleReserved(0)
+		t.orderFailed(&t.buyRetry, "MarketBuy", err)
+		return
+	}
+	t.buyRetry = orderRetry{}
+	if order.ExecutedQty < order.OrigQty {
+		fmt.Printf("[PARTIAL] [%s] Market buy %s after %.6f of %.6f\n", t.Symbol, order.Status, order.ExecutedQty, order.OrigQty)
+	}
+	t.recordBuy(order)
+}
+
+// recordBuy adds an executed buy order to the position and settles the
+// reservation with what it actually spent. Its fees are part of the cost,
+// so averageBuyPrice is the break-even price before selling.
+func (t *Trader) recordBuy(order *exchange.Order) {
+	t.settleReserved(quoteAmount(order) + order.Commission(t.quoteAsset()))
+
+	executedPrice := order.AvgPrice()
+	// Fees charged in the base asset reduce what we actually hold.
+	amount := order.ExecutedQty - order.Commission(t.baseAsset())
+	fee := t.orderFee(order)
+	cost := amount*executedPrice + fee
 
-	notional := amount * executedPrice
 	t.assetHeld += amount
-	t.usdcInvested += notional
+	t.usdcInvested += cost
 	t.averageBuyPrice = t.usdcInvested / t.assetHeld
 	t.trailingHigh = executedPrice
 	t.entries++
 	t.holding = true
 	if t.entries == 1 {
-		t.se.LastBuyTime = time.Now()
+		t.se.LastBuyTime = t.clock.Now()
 	}
-	t.db.LogTransaction(t.Symbol, "BUY", amount, executedPrice)
-	fmt.Printf("[TRADE] [%s] Bought at %.2f (%.2f USDC)\n", t.Symbol, executedPrice, notional)
+	t.logTrade("BUY", amount, executedPrice, fee)
+	fmt.Printf("[TRADE] [%s] Bought at %.2f (%.2f %s, fee %.4f)\n", t.Symbol, executedPrice, cost, t.quoteAsset(), fee)
+	t.protect(executedPrice)
 }
 
-func (t *Trader) canSell(price float64, history []float64) bool {
+// canSell reports whether the position may be sold this tick: something is
+// held and the minimum holding time has passed. It also tracks the trailing high.
+func (t *Trader) canSell(price float64) bool {
 	if !t.holding || t.assetHeld <= 0 {
 		return false
 	}
 
-	balance, _ := t.binClient.GetAssetBalance(strings.Replace(t.Symbol, "USDC", "", 1))
-	if balance == 0 {
+	// Protective orders lock the whole position, leaving no free balance.
+	balance, _ := t.ex.GetAssetBalance(t.baseAsset())
+	if balance == 0 && t.protection == nil {
 		t.resetState()
 		return false
 	}
 
-	holdingTime := time.Since(t.se.LastBuyTime)
+	holdingTime := t.since(t.se.LastBuyTime)
 	if holdingTime < t.minHoldDuration || holdingTime < t.minSellInterval {
 		return false
 	}
@@ -209,101 +347,149 @@ func (t *Trader) canSell(price float64, history []float64) bool {
 	if price > t.trailingHigh {
 		t.trailingHigh = price
 	}
-
-	commission := t.se.CommissionRate
-	netProfit := ((price * (1 - commission)) - (t.averageBuyPrice * (1 + commission))) / t.averageBuyPrice
-
-	if netProfit < t.se.MinProfitMargin {
-		return false
-	}
-
-	spread := t.binClient.GetSpread(t.Symbol)
-	if spread > 0.002 {
-		fmt.Printf("[SKIP] [%s] Spread too high: %.4f\n", t.Symbol, spread)
-		return false
-	}
-
-	if price < t.trailingHigh*(1-t.dynamicTrailingStop(netProfit)) && t.confirmDownTrend(history) {
-		return true
-	}
-
-	return t.se.ShouldSell(price, t.averageBuyPrice, history)
+	return true
 }
 
 func (t *Trader) trySell(price float64) {
-	step := t.binClient.GetSymbolFilter(t.Symbol).StepSize
-	sellAmount := roundQuantity(t.assetHeld, step)
+	if closed, err := t.unprotect(); closed || err != nil {
+		if err != nil {
+			t.notifier.Send(fmt.Sprintf("[ERROR] [%s] Sell skipped: %v", t.Symbol, err))
+		}
+		return
+	}
+
+	sellAmount := t.ex.GetSymbolFilter(t.Symbol).FloorQty(t.assetHeld, true)
 	if sellAmount <= 0 {
 		return
 	}
 
-	balance, _ := t.binClient.GetAssetBalance(strings.Replace(t.Symbol, "USDC", "", 1))
+	balance, _ := t.ex.GetAssetBalance(t.baseAsset())
 	if balance < sellAmount {
 		fmt.Printf("[SKIP] [%s] Not enough balance to sell (have %.4f, need %.4f)", t.Symbol, balance, sellAmount)
 		t.resetState()
 		return
 	}
 
-	executedPrice := price
-	var err error
-	if !t.demo {
-		executedPrice, err = t.binClient.MarketSell(t.Symbol, sellAmount)
-		if err != nil {
-			t.notifier.Send(fmt.Sprintf("[ERROR] [%s] MarketSell failed: %v", t.Symbol, err))
-			return
-		}
+	rec := t.recordIntent(exchange.SideSell, exchange.OrderTypeMarket, reasonExit, sellAmount, 0, 0)
+	order, err := t.ex.MarketSell(t.Symbol, sellAmount)
+	t.recordResult(rec, order, err)
+	if err == nil {
+		err = unfilled(order)
 	}
+	if err != nil {
+		t.orderFailed(&t.sellRetry, "MarketSell", err)
+		return
+	}
+	t.sellRetry = orderRetry{}
+	holdingTime := t.since(t.se.LastBuyTime)
+	netProfit := t.recordSell(order)
+	fmt.Printf("[TRADE] [%s] Sold at %.2f | NetProfit: %.2f%% | Held: %.0fmin\n", t.Symbol, order.AvgPrice(), netProfit*100, holdingTime.Minutes())
+}
 
-	usdcReturn := sellAmount * executedPrice
-	t.wallet.Release(usdcReturn)
+// recordSell books an executed sell order and returns the net profit of
+// the sold part after the fees paid on both sides. The position is closed
+// unless what remains can still be sold on its own, as after a partial fill.
+func (t *Trader) recordSell(order *exchange.Order) float64 {
+	executedPrice := order.AvgPrice()
+	// Only a fee charged in the quote asset reduces what reaches the
+	// wallet; fees in other assets still count against the profit.
+	t.wallet.Release(t.quoteAsset(), quoteAmount(order)-order.Commission(t.quoteAsset()))
+	fee := t.orderFee(order)
+	usdcReturn := quoteAmount(order) - fee
+
+	remaining := t.assetHeld - order.ExecutedQty - order.Commission(t.baseAsset())
+	if remaining > 0 && t.tradable(remaining, executedPrice) {
+		// The cost of the sold share leaves the position; the average buy
+		// price of the rest is unchanged.
+		cost := t.usdcInvested * (1 - remaining/t.assetHeld)
+		netProfit := 0.0
+		if cost > 0 {
+			netProfit = (usdcReturn - cost) / cost
+		}
+		t.assetHeld = remaining
+		t.usdcInvested -= cost
+		t.usdcProfit += usdcReturn - cost
+		t.lastSellTime = t.clock.Now()
+		t.lastSellPrice = executedPrice
+		t.lastSellProfit = netProfit * 100
+		t.logTrade("SELL", order.ExecutedQty, executedPrice, fee)
+		fmt.Printf("[PARTIAL] [%s] Sell %s after %.6f of %.6f; keeping %.6f\n", t.Symbol, order.Status, order.ExecutedQty, order.OrigQty, remaining)
+		return netProfit
+	}
 
-	commission := t.se.CommissionRate
-	netProfit := ((executedPrice * (1 - commission)) - (t.averageBuyPrice * (1 + commission))) / t.averageBuyPrice
-	holdingTime := time.Since(t.se.LastBuyTime)
+	netProfit := 0.0
+	if t.usdcInvested > 0 {
+		netProfit = (usdcReturn - t.usdcInvested) / t.usdcInvested
+	}
 
 	t.assetHeld = 0
 	t.holding = false
+	invested := t.usdcInvested
 	t.usdcProfit += usdcReturn - t.usdcInvested
 	t.usdcInvested = 0
 	t.averageBuyPrice = 0
 	t.trailingHigh = 0
 	t.entries = 0
-	t.lastSellTime = time.Now()
+	t.lastSellTime = t.clock.Now()
 	t.lastSellPrice = executedPrice
 	t.lastSellProfit = netProfit * 100
 
-	t.db.LogTransaction(t.Symbol, "SELL", sellAmount, executedPrice)
-	fmt.Printf("[TRADE] [%s] Sold at %.2f | NetProfit: %.2f%% | Held: %.0fmin\n", t.Symbol, executedPrice, netProfit*100, holdingTime.Minutes())
+	t.closePosition(usdcReturn - invested)
+	t.logTrade("SELL", order.ExecutedQty, executedPrice, fee)
+	return netProfit
+}
+
+// tradable reports whether quantity is still enough for a market sell at
+// price under the symbol's trading rules; anything less is dust.
+func (t *Trader) tradable(quantity, price float64) bool {
+	filter := t.ex.GetSymbolFilter(t.Symbol)
+	quantity = filter.FloorQty(quantity, true)
+	if quantity <= 0 {
+		return false
+	}
+	return filter.Check(exchange.OrderCheck{
+		Symbol:      t.Symbol,
+		Side:        exchange.SideSell,
+		Type:        exchange.OrderTypeMarket,
+		Quantity:    quantity,
+		MarketPrice: price,
+	}) == nil
 }
 
 func (t *Trader) updateBalances() {
-	if t.demo || t.dailyStartValue != 0 {
+	if t.dailyStartValue != 0 {
 		return
 	}
 
-	asset := strings.Replace(t.Symbol, "USDC", "", 1)
 	price := t.mw.GetPrice(t.Symbol)
-	balance, err := t.binClient.GetAssetBalance(asset)
-	if err != nil {
-		fmt.Printf("[WARN] [%s] Cannot fetch balance for %s: %v\n", t.Symbol, asset, err)
-		balance = 0
-	}
-
-	t.assetHeld = balance
-	if t.assetHeld > 0 {
-		if t.averageBuyPrice == 0 {
-			t.averageBuyPrice = price
+	// A reconciled position is already in line with the exchange.
+	if t.reconciliation == nil {
+		asset := t.baseAsset()
+		balance, err := t.ex.GetAssetBalance(asset)
+		if err != nil {
+			fmt.Printf("[WARN] [%s] Cannot fetch balance for %s: %v\n", t.Symbol, asset, err)
+			balance = 0
 		}
-		if t.usdcInvested == 0 {
-			t.usdcInvested = t.assetHeld * t.averageBuyPrice
+		if t.protection != nil {
+			balance += t.protection.quantity
+		}
+
+		t.assetHeld = balance
+		if t.assetHeld > 0 {
+			if t.averageBuyPrice == 0 {
+				t.averageBuyPrice = price
+			}
+			if t.usdcInvested == 0 {
+				t.usdcInvested = t.assetHeld * t.averageBuyPrice
+			}
+			t.holding = true
+			fmt.Printf("[SYNC] [%s] Resumed holding %.4f units\n", t.Symbol, t.assetHeld)
 		}
-		t.holding = true
-		fmt.Printf("[SYNC] [%s] Resumed holding %.4f units\n", t.Symbol, t.assetHeld)
 	}
 
-	t.dailyStartValue = t.assetHeld*price + t.wallet.Balance()
-	fmt.Printf("[INIT] [%s] Daily start set to %.2f (asset=%.2f, usdc=%.2f)\n",
-		t.Symbol, t.dailyStartValue, t.assetHeld*price, t.wallet.Balance())
+	t.dailyStartValue = t.assetHeld*price + t.wallet.Balance(t.quoteAsset())
+	fmt.Printf("[INIT] [%s] Daily start set to %.2f (asset=%.2f, %s=%.2f)\n",
+		t.Symbol, t.dailyStartValue, t.assetHeld*price, t.quoteAsset(), t.wallet.Balance(t.quoteAsset()))
 }
 
 func (t *Trader) resetIfInvalid(price float64) {
@@ -316,6 +502,7 @@ func (t *Trader) resetIfInvalid(price float64) {
 }
 
 func (t *Trader) resetState() {
+	t.closePosition(0)
 	t.assetHeld = 0
 	t.holding = false
 	t.averageBuyPrice = 0
@@ -324,30 +511,7 @@ func (t *Trader) resetState() {
 	t.usdcInvested = 0
 }
 
-func (t *Trader) confirmDownTrend(history []float64) bool {
-	if len(history) < 3 {
-		return false
-	}
-	return history[len(history)-1] < history[len(history)-2] &&
-		history[len(history)-2] < history[len(history)-3]
-}
-
-func (t *Trader) dynamicTrailingStop(netProfit float64) float64 {
-	switch {
-	case netProfit >= 0.06:
-		return 0.012
-	case netProfit >= 0.03:
-		return 0.015
-	case netProfit >= 0.015:
-		return 0.02
-	case netProfit >= 0.01:
-		return 0.025
-	default:
-		return 0.035
-	}
-}
-
-func (t *Trader) Summary(price float64) map[string]float64 {
+func (t *Trader) summary(price float64) map[string]float64 {
 	unrealized := t.assetHeld * price
 	return map[string]float64{
 		"assetHeld":         t.assetHeld,
@@ -357,104 +521,57 @@ func (t *Trader) Summary(price float64) map[string]float64 {
 		"totalValue":        t.totalValue(price),
 		"averageBuyPrice":   t.averageBuyPrice,
 		"usdcInvestedTotal": t.usdcProfit + unrealized,
-		"usdcBalance":       t.wallet.Balance(),
+		"usdcBalance":       t.wallet.Balance(t.quoteAsset()),
 	}
 }
 
-type StateSnapshot struct {
-	AssetHeld       float64
-	USDCInvested    float64
-	AverageBuyPrice float64
-	TrailingHigh    float64
-	Entries         int
-	Holding         bool
-	LastSellPrice   float64
-	LastSellTime    time.Time
+func (t *Trader) baseAsset() string {
+	base, _ := exchange.Assets(t.ex, t.Symbol)
+	return base
 }
 
-func (t *Trader) SnapshotState() StateSnapshot {
-	return StateSnapshot{
-		AssetHeld:       t.assetHeld,
-		USDCInvested:    t.usdcInvested,
-		AverageBuyPrice: t.averageBuyPrice,
-		TrailingHigh:    t.trailingHigh,
-		Entries:         t.entries,
-		Holding:         t.holding,
-		LastSellPrice:   t.lastSellPrice,
-		LastSellTime:    t.lastSellTime,
-	}
-}
-
-func (t *Trader) RestoreState(s StateSnapshot) {
-	t.assetHeld = s.AssetHeld
-	t.usdcInvested = s.USDCInvested
-	t.averageBuyPrice = s.AverageBuyPrice
-	t.trailingHigh = s.TrailingHigh
-	t.entries = s.Entries
-	t.holding = s.Holding
-	t.lastSellPrice = s.LastSellPrice
-	t.lastSellTime = s.LastSellTime
-}
-
-func roundQuantity(quantity float64, step float64) float64 {
-	return math.Floor(quantity/step) * step
+func (t *Trader) quoteAsset() string {
+	_, quote := exchange.Assets(t.ex, t.Symbol)
+	return quote
 }
 
 func (t *Trader) totalValue(price float64) float64 {
-	return t.wallet.Balance() + t.assetHeld*price
+	return t.wallet.Balance(t.quoteAsset()) + t.assetHeld*price
 }
 
-func (t *Trader) ForceSell() {
-	price := t.mw.GetPrice(t.Symbol)
-	step := t.binClient.GetSymbolFilter(t.Symbol).StepSize
-	sellAmount := roundQuantity(t.assetHeld, step)
-
-	if sellAmount <= 0 {
-		fmt.Printf("[FORCESELL] [%s] Nothing to sell\n", t.Symbol)
-		return
-	}
-
-	executedPrice := price
-	var err error
-	if !t.demo {
-		executedPrice, err = t.binClient.MarketSell(t.Symbol, sellAmount)
+func (t *Trader) forceSell() error {
+	t.cancelEntry()
+	if closed, err := t.unprotect(); closed || err != nil {
 		if err != nil {
-			msg := fmt.Sprintf("[FORCESELL ERROR] [%s] MarketSell failed: %v", t.Symbol, err)
+			msg := fmt.Sprintf("[FORCESELL ERROR] [%s] %v", t.Symbol, err)
 			fmt.Println(msg)
 			t.notifier.Send(msg)
-			return
 		}
+		return err
 	}
 
-	usdcReturn := sellAmount * executedPrice
-	t.wallet.Release(usdcReturn)
+	sellAmount := t.ex.GetSymbolFilter(t.Symbol).FloorQty(t.assetHeld, true)
 
-	t.db.LogTransaction(t.Symbol, "SELL", sellAmount, executedPrice)
+	if sellAmount <= 0 {
+		fmt.Printf("[FORCESELL] [%s] Nothing to sell\n", t.Symbol)
+		return nil
+	}
 
-	t.assetHeld = 0
-	t.holding = false
-	t.usdcProfit += usdcReturn - t.usdcInvested
-	t.usdcInvested = 0
-	t.averageBuyPrice = 0
-	t.trailingHigh = 0
-	t.entries = 0
-	t.lastSellTime = time.Now()
-	t.lastSellPrice = executedPrice
+	rec := t.recordIntent(exchange.SideSell, exchange.OrderTypeMarket, reasonForceSell, sellAmount, 0, 0)
+	order, err := t.ex.MarketSell(t.Symbol, sellAmount)
+	t.recordResult(rec, order, err)
+	if err == nil {
+		err = unfilled(order)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("[FORCESELL ERROR] [%s] MarketSell failed: %v", t.Symbol, err)
+		fmt.Println(msg)
+		t.notifier.Send(msg)
+		return err
+	}
+	t.recordSell(order)
 	t.lastSellProfit = 0
 
-	fmt.Printf("[FORCESELL] [%s] Sold %.4f at %.2f (%.2f USDC)\n", t.Symbol, sellAmount, executedPrice, usdcReturn)
-}
-
-func (t *Trader) SetInvestmentPerTrade(newAmount float64) {
-	t.investmentPerTrade = newAmount
-}
-
-func confirmBottomFormation(history []float64) bool {
-	if len(history) < 5 {
-		return false
-	}
-	n := len(history)
-	return history[n-3] < history[n-4] &&
-		history[n-2] > history[n-3] &&
-		history[n-1] > history[n-2]
+	fmt.Printf("[FORCESELL] [%s] Sold %.4f at %.2f (%.2f %s)\n", t.Symbol, order.ExecutedQty, order.AvgPrice(), quoteAmount(order), t.quoteAsset())
+	return nil
 }
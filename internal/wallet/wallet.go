@@ -4,59 +4,99 @@ import (
 	"fmt"
 	"log"
 	"sync"
-	"traderider/internal/binance"
+	"traderider/internal/exchange"
 	"traderider/internal/notifier"
 )
 
+// WalletManager tracks the free balance of each quote currency the traders
+// buy with, and the amounts they have reserved for pending buys.
 type WalletManager struct {
 	mu       sync.Mutex
-	USDC     float64
-	Demo     bool
-	Client   *binance.Client
+	balances map[string]float64
+	assets   []string
+	Client   exchange.Exchange
 	notifier *notifier.WhatsAppNotifier
 }
 
-func NewWalletManager(demo bool, client *binance.Client, notifier *notifier.WhatsAppNotifier) *WalletManager {
+// NewWalletManager tracks the given quote assets, or USDC when none are given.
+func NewWalletManager(client exchange.Exchange, notifier *notifier.WhatsAppNotifier, assets ...string) *WalletManager {
+	if len(assets) == 0 {
+		assets = []string{"USDC"}
+	}
 	return &WalletManager{
-		Demo:     demo,
+		balances: make(map[string]float64),
+		assets:   assets,
 		Client:   client,
 		notifier: notifier,
 	}
 }
 
+// Assets returns the tracked quote assets.
+func (w *WalletManager) Assets() []string {
+	return w.assets
+}
+
 func (w *WalletManager) Update() {
-	if w.Demo {
-		return
-	}
-	usdc, err := w.Client.GetUSDCBalance()
-	if err != nil {
-		log.Printf("[WALLET] Failed to fetch USDC balance: %v", err)
-		w.notifier.Send(fmt.Sprintf("[WALLET] Failed to fetch USDC balance: %v", err))
-		return
+	for _, asset := range w.assets {
+		balance, err := w.Client.GetAssetBalance(asset)
+		if err != nil {
+			log.Printf("[WALLET] Failed to fetch %s balance: %v", asset, err)
+			w.notifier.Send(fmt.Sprintf("[WALLET] Failed to fetch %s balance: %v", asset, err))
+			continue
+		}
+		w.mu.Lock()
+		w.balances[asset] = balance
+		w.mu.Unlock()
 	}
-	w.mu.Lock()
-	w.USDC = usdc
-	w.mu.Unlock()
 }
 
-func (w *WalletManager) Reserve(amount float64) bool {
+func (w *WalletManager) Reserve(asset string, amount float64) bool {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	if amount > w.USDC {
+	if amount > w.balances[asset] {
 		return false
 	}
-	w.USDC -= amount
+	w.balances[asset] -= amount
 	return true
 }
 
-func (w *WalletManager) Release(amount float64) {
+func (w *WalletManager) Release(asset string, amount float64) {
 	w.mu.Lock()
-	w.USDC += amount
+	w.balances[asset] += amount
 	w.mu.Unlock()
 }
 
-func (w *WalletManager) Balance() float64 {
+func (w *WalletManager) Balance(asset string) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.balances[asset]
+}
+
+// Balances returns a copy of the tracked balances by asset.
+func (w *WalletManager) Balances() map[string]float64 {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.USDC
+	out := make(map[string]float64, len(w.balances))
+	for asset, balance := range w.balances {
+		out[asset] = balance
+	}
+	return out
+}
+
+// ValuesIn returns each tracked balance converted into currency. Balances
+// that cannot be converted are left out and reported in missing.
+func (w *WalletManager) ValuesIn(currency string) (values map[string]float64, missing []string) {
+	values = make(map[string]float64)
+	for asset, balance := range w.Balances() {
+		if balance == 0 {
+			continue
+		}
+		rate := exchange.ConversionRate(w.Client, asset, currency)
+		if rate == 0 {
+			missing = append(missing, asset)
+			continue
+		}
+		values[asset] = balance * rate
+	}
+	return values, missing
 }
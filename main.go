@@ -1,168 +1,318 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"traderider/internal/notifier"
 
 	"traderider/internal/api"
 	"traderider/internal/binance"
 	"traderider/internal/config"
+	"traderider/internal/exchange"
 	"traderider/internal/market"
+	"traderider/internal/paper"
 	"traderider/internal/store"
 	"traderider/internal/strategy"
 	"traderider/internal/trader"
 	"traderider/internal/wallet"
 )
 
-func loadState(path string) (map[string]trader.StateSnapshot, error) {
-	states := make(map[string]trader.StateSnapshot)
-	data, err := os.ReadFile(path)
-	if err != nil {
+// loadStates returns the trader states saved in the store. Without any, a
+// state file from before states were kept in the store is imported instead.
+// A corrupt state is an error rather than a fresh start.
+func loadStates(db *store.Store, legacyFile string) (map[string]trader.StateSnapshot, error) {
+	states, err := trader.LoadStates(db)
+	if err != nil || len(states) > 0 {
 		return states, err
 	}
-	err = json.Unmarshal(data, &states)
-	return states, err
-}
-
-func saveState(path string, states map[string]trader.StateSnapshot) error {
-	data, err := json.MarshalIndent(states, "", "  ")
+	data, err := os.ReadFile(legacyFile)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var legacy map[string]json.RawMessage
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("%s is corrupt: %w", legacyFile, err)
 	}
-	return os.WriteFile(path, data, 0644)
+	for symbol, raw := range legacy {
+		s, err := trader.DecodeState(store.TraderState{Symbol: symbol, Version: 1, Data: raw})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", legacyFile, err)
+		}
+		states[symbol] = s
+	}
+	log.Printf("[STATE] Imported %d trader states from %s", len(states), legacyFile)
+	return states, nil
 }
 
-func TotalPortfolioValue(symbols []string, wm *wallet.WalletManager, mw *market.MarketWatcher, binClient *binance.Client) float64 {
-	total := wm.Balance()
-	for _, symbol := range symbols {
-		asset := symbol[:len(symbol)-4]
-		balance, err := binClient.GetAssetBalance(asset)
-		if err == nil {
-			price := mw.GetPrice(symbol)
-			total += balance * price
+// newTrader builds the strategy engine and trader for a symbol from its
+// configured parameters. It is shared by the live bot and the backtester.
+func newTrader(cfg *config.Config, symbol string, db *store.Store, mw *market.MarketWatcher, ex exchange.Exchange, wm *wallet.WalletManager, n *notifier.WhatsAppNotifier) *trader.Trader {
+	p := cfg.ParamsFor(symbol)
+	if tf := p.Timeframe; tf != "" {
+		if _, ok := market.Intervals[tf]; !ok {
+			log.Fatalf("[%s] Unknown strategy timeframe %q", symbol, tf)
 		}
 	}
-	return total
-}
 
-func MonitorPortfolioHardStop(symbols []string, wm *wallet.WalletManager, mw *market.MarketWatcher, binClient *binance.Client, startValue float64, stopChans map[string]chan struct{}) {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+	se := strategy.NewEngine(p.ShortEMA, p.LongEMA, p.MinProfitMargin)
+	se.MaxHoldingDuration = time.Duration(p.MaxHoldingMinutes) * time.Minute
+	se.MinTradeGapPercent = p.MinTradeGapPercent
+	se.SoftStopLoss = p.SoftStopLoss
+	se.UseBollinger = p.UseBollinger
+	se.BollingerWindow = p.BollingerWindow
+	se.CommissionRate = p.CommissionRate
+	se.ReentryDropPercent = p.ReentryDropPercent
+	se.DCADropPercent = p.DCADropPercent
+	se.MaxBuyRSI = p.MaxBuyRSI
+	se.BollingerBuyMargin = p.BollingerBuyMargin
+	se.MaxSpread = p.MaxSpread
+	se.TrailingStops = p.TrailingStops
 
-	for range ticker.C {
-		value := TotalPortfolioValue(symbols, wm, mw, binClient)
-		if value < startValue*0.9 {
-			log.Printf("[HARD-STOP] Portfolio value %.2f < 90%% of start %.2f. Stopping all traders.", value, startValue)
-			for _, ch := range stopChans {
-				close(ch)
-			}
-			return
-		}
+	tr := trader.NewTrader(db, mw, se, trader.Config{
+		InvestmentPerTrade:    p.InvestmentPerTrade,
+		MinHoldingThreshold:   p.MinHoldingThreshold,
+		MinHoldDuration:       time.Duration(p.MinHoldMinutes) * time.Minute,
+		MinSellInterval:       time.Duration(p.MinSellIntervalMinutes) * time.Minute,
+		MaxEntries:            p.MaxEntries,
+		Cooldown:              time.Duration(p.CooldownSeconds) * time.Second,
+		EntryMode:             p.EntryMode,
+		MakerTimeout:          time.Duration(p.MakerTimeoutSeconds) * time.Second,
+		MakerMaxReprices:      p.MakerMaxReprices,
+		MakerFallbackMarket:   p.MakerFallbackMarket,
+		Protection:            p.Protection,
+		ProtectionStopLoss:    p.ProtectionStopLoss,
+		ProtectionTakeProfit:  p.ProtectionTakeProfit,
+		ProtectionLimitOffset: p.ProtectionLimitOffset,
+		ProtectionUpdateStep:  p.ProtectionUpdateStep,
+	}, ex, wm, n)
+
+	st, err := strategy.New(p.Name, se)
+	if err != nil {
+		log.Fatalf("[%s] %v", symbol, err)
 	}
+	tr.SetStrategy(st)
+	tr.Symbol = symbol
+	tr.Timeframe = p.Timeframe
+	return tr
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backtest" {
+		runBacktest(os.Args[2:])
+		return
+	}
+
 	cfg := config.Load("config/config.yml")
-	log.Printf("[INFO] Starting TradeRider in %s mode", cfg.Mode)
+	// Cancelled on SIGINT or SIGTERM; every goroutine below stops with it.
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	// Background work, traders included, outlives the signal until the API
+	// has finished the requests it is serving, which may need the traders.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	var wg sync.WaitGroup
+	spawn := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
 
-	db, err := store.NewStore("traderider.db")
+	// Testnet runs keep their own trade history and state so they never
+	// reconcile against production.
+	dbFile, stateName := "traderider.db", "state.json"
+	if cfg.Binance.UseTestnet {
+		log.Printf("[INFO] Starting TradeRider in %s mode on the Binance Spot TESTNET", cfg.Mode)
+		dbFile, stateName = "traderider-testnet.db", "state-testnet.json"
+	} else {
+		log.Printf("[INFO] Starting TradeRider in %s mode", cfg.Mode)
+	}
+
+	db, err := store.NewStore(dbFile)
 	if err != nil {
 		log.Fatalf("Failed to initialize store: %v", err)
 	}
 
 	whNotifier := notifier.NewWhatsAppNotifier(cfg.WhatsApp.Phone, cfg.WhatsApp.APIKey)
-	binClient := binance.NewClient(cfg.Binance.APIKey, cfg.Binance.SecretKey, whNotifier)
+	if cfg.Binance.UseTestnet {
+		whNotifier.Prefix = "[TESTNET] "
+	}
+	apiKey, secretKey := cfg.BinanceCredentials()
+	binClient := binance.NewClient(apiKey, secretKey, cfg.Binance.UseTestnet, whNotifier)
+	binClient.MaxClockDrift = time.Duration(cfg.Binance.MaxClockDriftMs) * time.Millisecond
+	spawn(func() { binClient.RefreshFilters(ctx, time.Hour) })
+	spawn(func() { binClient.SyncTime(ctx, 10*time.Minute) })
 	demo := cfg.Mode != "real"
 
-	wm := wallet.NewWalletManager(demo, binClient, whNotifier)
-	go func() {
-		for range time.Tick(5 * time.Second) {
-			wm.Update()
+	os.MkdirAll("data", os.ModePerm)
+
+	symbols := cfg.SymbolNames()
+	var quotes []string
+	seenQuote := make(map[string]bool)
+	for _, symbol := range symbols {
+		_, quote := exchange.Assets(binClient, symbol)
+		if quote == "" {
+			log.Fatalf("Cannot tell the quote asset of %s", symbol)
 		}
-	}()
+		if !seenQuote[quote] {
+			seenQuote[quote] = true
+			quotes = append(quotes, quote)
+		}
+	}
 
-	symbols := []string{"BTCUSDC", "XRPUSDC", "SOLUSDC", "LINKUSDC", "SUIUSDC"}
-	marketWatcher := market.NewWatcher(demo, binClient)
-	go marketWatcher.Start(symbols)
+	var ex exchange.Exchange = binClient
+	var paperEx *paper.Exchange
+	paperFile := filepath.Join("data", "paper.json")
+	if demo {
+		startingBalance := cfg.Paper.StartingBalance
+		if startingBalance == 0 {
+			startingBalance = 1000
+		}
+		balances := cfg.Paper.StartingBalances
+		if len(balances) == 0 {
+			balances = make(map[string]float64)
+			for _, quote := range quotes {
+				balances[quote] = startingBalance
+			}
+		}
+		paperEx = paper.NewExchange(binClient, paper.Config{
+			StartingBalances: balances,
+			CommissionRate:   cfg.Paper.CommissionRate,
+			Slippage:         cfg.Paper.Slippage,
+		})
+		if err := paperEx.Load(paperFile); err != nil {
+			log.Fatalf("Failed to load paper balances: %v", err)
+		}
+		ex = paperEx
+		log.Printf("[PAPER] Simulated exchange balances: %v", paperEx.Balances())
+	}
 
-	traders := make(map[string]*trader.Trader)
-	stopChans := make(map[string]chan struct{})
+	wm := wallet.NewWalletManager(ex, whNotifier, quotes...)
+	wm.Update()
+	spawn(func() { every(ctx, 5*time.Second, wm.Update) })
 
-	stateFile := filepath.Join("data", "state.json")
-	os.MkdirAll("data", os.ModePerm)
-	loadedStates, _ := loadState(stateFile)
+	marketWatcher := market.NewWatcher(ex)
+	spawn(func() { marketWatcher.Start(ctx, symbols) })
+	spawn(func() { marketWatcher.Persist(ctx, db, time.Duration(cfg.History.RetentionDays)*24*time.Hour) })
 
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		for range ticker.C {
-			allStates := make(map[string]trader.StateSnapshot)
-			for symbol, tr := range traders {
-				allStates[symbol] = tr.SnapshotState()
-			}
-			saveState(stateFile, allStates)
-		}
-	}()
+	traders := make(map[string]*trader.Trader)
+
+	loadedStates, err := loadStates(db, filepath.Join("data", stateName))
+	if err != nil {
+		log.Fatalf("[STATE] Cannot load saved trader state: %v", err)
+	}
 
 	for _, symbol := range symbols {
-		se := strategy.NewEngine(
-			cfg.Strategy.ShortEMA,
-			cfg.Strategy.LongEMA,
-			cfg.Strategy.MinProfitMargin,
-		)
-		se.MaxHoldingDuration = time.Duration(cfg.Strategy.MaxHoldingMinutes) * time.Minute
-		se.MinTradeGapPercent = cfg.Strategy.MinTradeGapPercent
-		se.SoftStopLoss = cfg.Strategy.SoftStopLoss
-		se.UseBollinger = cfg.Strategy.UseBollinger
-		se.BollingerWindow = cfg.Strategy.BollingerWindow
-		se.CommissionRate = cfg.Strategy.CommissionRate
-
-		stopCh := make(chan struct{})
-		stopChans[symbol] = stopCh
-
-		tr := trader.NewTrader(
-			db, marketWatcher, se, demo,
-			cfg.Strategy.InvestmentPerTrade,
-			binClient,
-			cfg.Strategy.MinHoldingThreshold,
-			time.Duration(cfg.Strategy.MinHoldMinutes)*time.Minute,
-			wm,
-			stopCh,
-			whNotifier,
-		)
-		tr.Symbol = symbol
+		tr := newTrader(cfg, symbol, db, marketWatcher, ex, wm, whNotifier)
 
+		var saved *trader.StateSnapshot
 		if state, ok := loadedStates[symbol]; ok {
-			tr.RestoreState(state)
+			saved = &state
 			log.Printf("[RESTORE] %s: Holding=%.6f AvgBuy=%.2f Entries=%d", symbol, state.AssetHeld, state.AverageBuyPrice, state.Entries)
 		}
+		if saved != nil && saved.Mode != "" && saved.Mode != trader.ModeActive {
+			log.Printf("[RESTORE] %s is %s; resume via POST /api/traders/%s/resume", symbol, saved.Mode, symbol)
+		}
+		if rec := tr.Reconcile(saved); !rec.Consistent() {
+			msg := fmt.Sprintf("[RECONCILE] %s will not trade until reconciled: %s", symbol, strings.Join(rec.Issues, "; "))
+			log.Print(msg)
+			whNotifier.Send(msg)
+		}
 
 		traders[symbol] = tr
-		go tr.Run()
+		spawn(func() { tr.Run(ctx) })
 		log.Printf("[INFO] Started trader for %s", symbol)
 	}
 
-	startPortfolioValue := TotalPortfolioValue(symbols, wm, marketWatcher, binClient)
-	go MonitorPortfolioHardStop(symbols, wm, marketWatcher, binClient, startPortfolioValue, stopChans)
+	// Trades save the state with them and the paper exchange saves itself on
+	// every order change; this catches everything else, such as a raised
+	// trailing high.
+	saveAll := func() {
+		for symbol, tr := range traders {
+			if err := tr.SaveState(); err != nil {
+				log.Printf("[ERROR] Failed to save %s state: %v", symbol, err)
+			}
+		}
+		if paperEx != nil {
+			if err := paperEx.Save(paperFile); err != nil {
+				log.Printf("[ERROR] Failed to save paper balances: %v", err)
+			}
+		}
+	}
+	spawn(func() { every(ctx, 30*time.Second, saveAll) })
 
-	server := api.NewServer(db.DB, marketWatcher, traders, wm, binClient, symbols)
-	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
-		defer ticker.Stop()
+	hardStop := newHardStop(symbols, wm, marketWatcher, ex, cfg.ReportingCurrency, traders)
+	spawn(func() { hardStop.monitor(ctx) })
 
-		for range ticker.C {
+	server := api.NewServer(db, marketWatcher, traders, wm, ex, symbols)
+	server.Config = cfg
+	spawn(func() {
+		every(ctx, time.Hour, func() {
 			log.Println("[REBALANCE] Triggered automatic rebalance")
 			server.RebalanceAllocations()
-		}
-	}()
+		})
+	})
 
 	http.Handle("/", http.FileServer(http.Dir("./web")))
 	http.Handle("/api/", server.Router)
-
+	httpServer := &http.Server{Addr: ":1010"}
+	go func() {
+		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
 	log.Println("[INFO] TradeRider server running at http://localhost:1010")
-	log.Fatal(http.ListenAndServe(":1010", nil))
+
+	<-signals.Done()
+	// A second signal kills the process instead of waiting.
+	stopSignals()
+	log.Println("[SHUTDOWN] Stopping: no new trades, finishing API requests")
+
+	// The traders stop ticking at once but keep serving the API requests in
+	// progress, e.g. a force sell; they stop for good once those finish.
+	for _, tr := range traders {
+		tr.Drain()
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[SHUTDOWN] HTTP server: %v", err)
+	}
+	stop()
+	wg.Wait()
+
+	saveAll()
+	if err := db.DB.Close(); err != nil {
+		log.Printf("[SHUTDOWN] Closing database: %v", err)
+	}
+	log.Println("[SHUTDOWN] State saved, exiting")
+}
+
+// every calls fn each interval until ctx is done.
+func every(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
 }